@@ -0,0 +1,68 @@
+// Provides management commands for operating the WIG-Server from the command line.
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+// Represents a management command, e.g. "clients create".
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// The available commands, keyed by their group and name.
+var commands = map[string]map[string]command{
+	"clients": {
+		"create": {"clients create <name> [scopes]", createClient},
+		"list":   {"clients list", listClients},
+		"scopes": {"clients scopes <clientUID> <scopes>", setClientScopes},
+		"revoke": {"clients revoke <clientUID>", revokeClient},
+	},
+	"locations": {
+		"repair": {"locations repair", repairLocations},
+	},
+	"users": {
+		"promote": {"users promote <username>", promoteUser},
+		"demote":  {"users demote <username>", demoteUser},
+	},
+}
+
+/*
+* Runs a management command.
+*
+* @param args The command line arguments, without the program name.
+*
+* @return int The exit code.
+ */
+func Run(args []string) int {
+	if len(args) < 2 {
+		printUsage()
+		return 2
+	}
+
+	cmd, ok := commands[args[0]][args[1]]
+	if !ok {
+		printUsage()
+		return 2
+	}
+
+	if err := cmd.run(args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\nusage: WIG-Server %s\n", err, cmd.usage)
+		return 1
+	}
+	return 0
+}
+
+/*
+* Prints the usage of every command.
+ */
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, group := range commands {
+		for _, cmd := range group {
+			fmt.Fprintf(os.Stderr, "  WIG-Server %s\n", cmd.usage)
+		}
+	}
+}
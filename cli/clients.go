@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The prefix of every API client key, so keys can be recognized.
+const clientKeyPrefix = "wig_app_"
+
+// The scopes an API client can be granted, one for each top level route group.
+var clientScopes = []string{"*", "user", "app", "admin"}
+
+/*
+* Checks that every scope in a comma separated list can be granted to an API client.
+*
+* @param scopes The comma separated scopes.
+*
+* @return string The normalized scopes.
+* @return error The error message, if there is one.
+ */
+func validateClientScopes(scopes string) (string, error) {
+	list := utils.SplitScopes(scopes)
+	if len(list) == 0 {
+		return "", errors.New("at least one scope is required")
+	}
+
+	for _, scope := range list {
+		valid := false
+		for _, allowed := range clientScopes {
+			if scope == allowed {
+				valid = true
+			}
+		}
+		if !valid {
+			return "", fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(clientScopes, ", "))
+		}
+	}
+	return strings.Join(list, ","), nil
+}
+
+/*
+* Registers a new API client and prints its key, which is only shown once.
+*
+* @param args The client name and optional comma separated scopes, defaulting to all scopes.
+*
+* @return error The error message, if there is one.
+ */
+func createClient(args []string) error {
+	if len(args) < 1 || args[0] == "" {
+		return errors.New("a client name is required")
+	}
+
+	scopes := "*"
+	if len(args) > 1 {
+		scopes = args[1]
+	}
+	scopes, err := validateClientScopes(scopes)
+	if err != nil {
+		return err
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	key := clientKeyPrefix + secret
+
+	client := models.ApiClient{
+		ClientName: args[0],
+		KeyPrefix:  key[:len(clientKeyPrefix)+4],
+		KeyHash:    utils.HashToken(key),
+		Scopes:     scopes,
+	}
+	if err := db.DB.Create(&client).Error; err != nil {
+		return err
+	}
+
+	fmt.Printf("Created client %d (%s) with scopes %s\n", client.ClientUID, client.ClientName, client.Scopes)
+	fmt.Printf("Key, store it now as it cannot be shown again:\n%s\n", key)
+	return nil
+}
+
+/*
+* Prints every registered API client and its usage.
+*
+* @param args Unused.
+*
+* @return error The error message, if there is one.
+ */
+func listClients(args []string) error {
+	var clients []models.ApiClient
+	if err := db.DB.Order("client_uid").Find(&clients).Error; err != nil {
+		return err
+	}
+
+	fmt.Printf("%-6s %-24s %-14s %-12s %-10s %-20s %s\n", "UID", "NAME", "KEY", "SCOPES", "USES", "LAST USED", "STATUS")
+	for _, client := range clients {
+		lastUsed := "never"
+		if client.LastUsedAt != nil {
+			lastUsed = client.LastUsedAt.Format(time.DateTime)
+		}
+		status := "active"
+		if client.RevokedAt != nil {
+			status = "revoked"
+		}
+		fmt.Printf("%-6d %-24s %-14s %-12s %-10d %-20s %s\n", client.ClientUID, client.ClientName, client.KeyPrefix+"...",
+			client.Scopes, client.UsageCount, lastUsed, status)
+	}
+	return nil
+}
+
+/*
+* Replaces the scopes of an API client.
+*
+* @param args The client UID and the comma separated scopes.
+*
+* @return error The error message, if there is one.
+ */
+func setClientScopes(args []string) error {
+	if len(args) < 2 {
+		return errors.New("a client UID and scopes are required")
+	}
+
+	scopes, err := validateClientScopes(args[1])
+	if err != nil {
+		return err
+	}
+
+	result := db.DB.Model(&models.ApiClient{}).Where("client_uid = ?", args[0]).Update("scopes", scopes)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("client %s was not found", args[0])
+	}
+
+	fmt.Printf("Client %s now has scopes %s\n", args[0], scopes)
+	return nil
+}
+
+/*
+* Revokes an API client, its key is rejected from then on.
+*
+* @param args The client UID.
+*
+* @return error The error message, if there is one.
+ */
+func revokeClient(args []string) error {
+	if len(args) < 1 {
+		return errors.New("a client UID is required")
+	}
+
+	now := time.Now()
+	result := db.DB.Model(&models.ApiClient{}).Where("client_uid = ? AND revoked_at IS NULL", args[0]).Update("revoked_at", &now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("active client %s was not found", args[0])
+	}
+
+	fmt.Printf("Client %s was revoked\n", args[0])
+	return nil
+}
@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"WIG-Server/controller"
+	"fmt"
+)
+
+/*
+* Repairs locations that were nested inside of themselves.
+*
+* @param args Unused.
+*
+* @return error The error message, if there is one.
+ */
+func repairLocations(args []string) error {
+	repaired := controller.RepairLocationCycles()
+	fmt.Printf("Repaired %d location loops\n", repaired)
+	return nil
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"errors"
+	"fmt"
+)
+
+/*
+* Sets the role of a user.
+*
+* @param username The username.
+* @param role The new role.
+*
+* @return error The error message, if there is one.
+ */
+func setUserRole(username string, role string) error {
+	result := db.DB.Model(&models.User{}).Where("username = ?", username).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		db.DB.Model(&models.User{}).Where("username = ?", username).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("user %s was not found", username)
+		}
+	}
+
+	fmt.Printf("User %s now has the %s role\n", username, role)
+	return nil
+}
+
+/*
+* Gives a user the admin role, allowing them to use the admin API.
+*
+* @param args The username.
+*
+* @return error The error message, if there is one.
+ */
+func promoteUser(args []string) error {
+	if len(args) < 1 || args[0] == "" {
+		return errors.New("a username is required")
+	}
+	return setUserRole(args[0], models.RoleAdmin)
+}
+
+/*
+* Takes the admin role away from a user.
+*
+* @param args The username.
+*
+* @return error The error message, if there is one.
+ */
+func demoteUser(args []string) error {
+	if len(args) < 1 || args[0] == "" {
+		return errors.New("a username is required")
+	}
+	return setUserRole(args[0], models.RoleUser)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The prefix of every personal access token, used by ValidateToken to recognize them.
+const AccessTokenPrefix = "wig_pat_"
+
+// The route groups a personal access token can be scoped to, each with a read and write scope.
+var accessTokenGroups = []string{"ownership", "location", "borrower", "scan", "audit", "trash"}
+
+/*
+* Checks that every scope can be granted to a personal access token.
+* Scopes have the form "group:read", "group:write" or "group:*", account management is never granted.
+*
+* @param scopes The requested scopes.
+*
+* @return string The normalized, comma separated scopes.
+* @return bool Whether all of the scopes are valid.
+ */
+func validateAccessTokenScopes(scopes []string) (string, bool) {
+	if len(scopes) == 0 {
+		return "", false
+	}
+
+	for _, scope := range scopes {
+		group, access, found := strings.Cut(scope, ":")
+		if !found || (access != "read" && access != "write" && access != "*") {
+			return "", false
+		}
+
+		valid := false
+		for _, allowed := range accessTokenGroups {
+			if group == allowed {
+				valid = true
+			}
+		}
+		if !valid {
+			return "", false
+		}
+	}
+	return strings.Join(scopes, ","), true
+}
+
+/*
+* Returns all active personal access tokens of the user.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AccessTokenList(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	var tokens []models.PersonalAccessToken
+	db.DB.Where("pat_user = ? AND revoked_at IS NULL", user.UserUID).Order("created_at DESC").Find(&tokens)
+
+	tokensDTO := DTO("tokens", tokens)
+	return Success(c, "Tokens returned", tokensDTO)
+}
+
+/*
+* Creates a personal access token with the requested scopes and optional expiry.
+* The token is only returned in this response.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AccessTokenCreate(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request
+	var request struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn string   `json:"expiresIn"`
+	}
+	err := c.BodyParser(&request)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if request.Name == "" {
+		return Error(c, 400, "Name is empty and required")
+	}
+	scopes, ok := validateAccessTokenScopes(request.Scopes)
+	if !ok {
+		return Error(c, 400, "Scopes must be of the form group:read, group:write or group:*, where group is one of "+strings.Join(accessTokenGroups, ", "))
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresIn != "" {
+		lifetime, err := time.ParseDuration(request.ExpiresIn)
+		if err != nil || lifetime <= 0 {
+			return Error(c, 400, "ExpiresIn must be a positive duration, e.g. 720h")
+		}
+		expiry := time.Now().Add(lifetime)
+		expiresAt = &expiry
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return Error(c, 500, "There was an error generating the token")
+	}
+	token := AccessTokenPrefix + secret
+
+	accessToken := models.PersonalAccessToken{
+		TokenUser:   user.UserUID,
+		TokenName:   request.Name,
+		TokenPrefix: token[:len(AccessTokenPrefix)+4],
+		TokenHash:   utils.HashToken(token),
+		Scopes:      scopes,
+		ExpiresAt:   expiresAt,
+	}
+	db.DB.Create(&accessToken)
+
+	accessTokenDTO := DTO("accessToken", accessToken)
+	tokenDTO := DTO("token", token)
+	return Success(c, "Token was successfully created", accessTokenDTO, tokenDTO)
+}
+
+/*
+* Revokes one of the users personal access tokens.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AccessTokenRevoke(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	tokenUID := c.Query("tokenUID")
+
+	// Validate token
+	var accessToken models.PersonalAccessToken
+	result := db.DB.Where("pat_uid = ? AND pat_user = ? AND revoked_at IS NULL", tokenUID, user.UserUID).First(&accessToken)
+	code, err := RecordExists("Token", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	db.DB.Model(&accessToken).Update("revoked_at", time.Now())
+
+	return Success(c, "Token was successfully revoked")
+}
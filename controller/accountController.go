@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/mailer"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+/*
+* Checks the current credential of a user before a sensitive account change.
+* Users with two-factor authentication also have to provide a TOTP code or recovery code.
+*
+* @param user The user making the change.
+* @param data The request body containing currentHash, and code or recoveryCode.
+*
+* @return int The HTTP error code to return
+* @return error The error message, if there is one.
+ */
+func confirmCredential(user models.User, data map[string]string) (int, error) {
+	if data["currentHash"] == "" {
+		return 400, errors.New("Current hash is empty and required")
+	}
+
+	match, _, err := utils.VerifyPassword(data["currentHash"], user.Hash)
+	if err != nil {
+		return 500, errors.New("There was an error verifying the password")
+	}
+	if !match {
+		return 401, errors.New("The current password is incorrect")
+	}
+
+	if user.TOTPEnabled && !verifySecondFactor(user, data["code"], data["recoveryCode"]) {
+		return 401, errors.New("The two-factor code is invalid")
+	}
+	return 200, nil
+}
+
+/*
+* Removes a user, all of their credentials and their household memberships.
+* Households nobody else belongs to are deleted along with their ownerships, locations and borrowers,
+* what the user added to other households is handed to their owners.
+*
+* @param tx The transaction to delete the records in.
+* @param uid The users UID.
+*
+* @return error The error message, if there is one.
+ */
+func deleteUserData(tx *gorm.DB, uid uint) error {
+	if err := leaveHouseholds(tx, uid); err != nil {
+		return err
+	}
+	if err := reassignUserRecords(tx, uid); err != nil {
+		return err
+	}
+
+	deletes := []struct {
+		query string
+		model interface{}
+	}{
+		{"session_user = ?", &models.Session{}},
+		{"token_user = ?", &models.RefreshToken{}},
+		{"token_user = ?", &models.ActionToken{}},
+		{"code_user = ?", &models.RecoveryCode{}},
+		{"pat_user = ?", &models.PersonalAccessToken{}},
+		{"identity_user = ?", &models.ExternalIdentity{}},
+		{"user_uid = ?", &models.User{}},
+	}
+
+	for _, d := range deletes {
+		if err := tx.Where(d.query, uid).Delete(d.model).Error; err != nil {
+			return err
+		}
+	}
+	log.Printf("controller#deleteUserData: User %d and all of their records were deleted", uid)
+	return nil
+}
+
+/*
+* Deletes every account whose deletion grace period has passed.
+* Called periodically by the tasks package.
+ */
+func PurgeScheduledAccounts() {
+	var users []models.User
+	db.DB.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).Find(&users)
+
+	for _, user := range users {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			return deleteUserData(tx, user.UserUID)
+		})
+		if err != nil {
+			log.Printf("controller#PurgeScheduledAccounts: Error deleting user %d: %v", user.UserUID, err)
+		}
+	}
+}
+
+/*
+* Changes the users email address after confirming their current credential.
+* The new address has to be verified again.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserChangeEmail(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["email"] == "" {
+		return Error(c, 400, "Email is empty and required")
+	}
+	if data["email"] == user.Email {
+		return Error(c, 400, "Email is the same as the current email")
+	}
+
+	code, err := confirmCredential(user, data)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Query for email in database
+	var existing models.User
+	result := db.DB.Where("email = ?", data["email"]).First(&existing)
+	code, err = recordNotInUse("Email", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Check email requirements
+	if !emailRegex.MatchString(data["email"]) {
+		return Error(c, 400, "Email does not match requirements")
+	}
+	domain := strings.Split(data["email"], "@")[1]
+	if _, err := net.LookupMX(domain); err != nil {
+		return Error(c, 400, "Email domain does not exist")
+	}
+
+	oldEmail := user.Email
+	user.Email = data["email"]
+	user.EmailConfirm = "false"
+	db.DB.Model(&user).Updates(map[string]interface{}{"email": user.Email, "email_confirm": user.EmailConfirm})
+
+	// Let the previous address know, in case the change was not made by the owner
+	notice := "Hi " + user.Username + ",\n\nThe email address of your WIG account was changed to " + user.Email + ".\n\n" +
+		"If you did not make this change, reset your password and contact support."
+	if err := mailer.Send(oldEmail, "Your WIG email address was changed", notice); err != nil {
+		log.Printf("controller#UserChangeEmail: Error notifying previous email: %v", err)
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("controller#UserChangeEmail: Error sending verification email: %v", err)
+	}
+
+	return Success(c, "Email was successfully changed, please verify the new address")
+}
+
+/*
+* Changes the users salt and hash after confirming their current credential.
+* All other sessions of the user are revoked.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserChangePassword(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	session := c.Locals("session").(models.Session)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["salt"] == "" || data["hash"] == "" {
+		return Error(c, 400, "Salt or hash is empty and required")
+	}
+
+	code, err := confirmCredential(user, data)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	hash, err := utils.HashPassword(data["hash"])
+	if err != nil {
+		return Error(c, 500, "There was an error hashing the password")
+	}
+
+	db.DB.Model(&user).Updates(map[string]interface{}{"salt": data["salt"], "hash": hash})
+	revokeUserSessions(user.UserUID, session.SessionUID)
+
+	return Success(c, "Password was successfully changed")
+}
+
+/*
+* Deletes the users account along with every household only they belong to.
+* When ACCOUNT_DELETION_GRACE is set the deletion is scheduled instead, and logging in again cancels it.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserDelete(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	code, err := confirmCredential(user, data)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	grace := utils.EnvDuration("ACCOUNT_DELETION_GRACE", 0)
+	if grace > 0 {
+		scheduled := time.Now().Add(grace)
+		db.DB.Model(&user).Update("deletion_scheduled_at", &scheduled)
+		revokeUserSessions(user.UserUID, 0)
+
+		scheduledDTO := DTO("deletionScheduledAt", scheduled)
+		return Success(c, "Account deletion scheduled, log in again to cancel", scheduledDTO)
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteUserData(tx, user.UserUID)
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error deleting the account")
+	}
+
+	return Success(c, "Account was successfully deleted")
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/db/dbtest"
+	"WIG-Server/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestDeleteUserDataHandsRecordsToHouseholdOwner(t *testing.T) {
+	dbtest.Open(t)
+
+	owner, household := testUser(t, "owner")
+	member, _ := testUser(t, "member")
+	db.DB.Create(&models.Membership{Household: household.HouseholdUID, MemberUser: member.UserUID, MemberRole: models.HouseholdEditor, JoinedAt: time.Now()})
+
+	// The member adds records to the shared household, one of them already in the trash
+	location := models.Location{LocationName: "Garage", LocationOwner: member.UserUID, LocationHousehold: household.HouseholdUID}
+	db.DB.Create(&location)
+	ownership := models.Ownership{ItemOwner: member.UserUID, ItemHousehold: household.HouseholdUID, ItemNumber: 1, CustomItemName: "Drill", ItemLocation: location.LocationUID}
+	db.DB.Create(&ownership)
+	trashed := models.Ownership{ItemOwner: member.UserUID, ItemHousehold: household.HouseholdUID, ItemNumber: 1, CustomItemName: "Saw"}
+	db.DB.Create(&trashed)
+	db.DB.Delete(&trashed)
+	borrower := models.Borrower{BorrowerName: "Neighbour", BorrowerOwner: member.UserUID, BorrowerHousehold: household.HouseholdUID}
+	db.DB.Create(&borrower)
+	event := models.OwnershipEvent{EventOwnership: ownership.OwnershipUID, EventHousehold: household.HouseholdUID, EventType: models.OwnershipCreated, Actor: member.UserUID}
+	db.DB.Create(&event)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteUserData(tx, member.UserUID)
+	})
+	if err != nil {
+		t.Fatalf("deleteUserData failed: %v", err)
+	}
+
+	var users int64
+	db.DB.Model(&models.User{}).Where("user_uid = ?", member.UserUID).Count(&users)
+	if users != 0 {
+		t.Errorf("member was not deleted")
+	}
+
+	db.DB.Unscoped().First(&ownership, ownership.OwnershipUID)
+	db.DB.Unscoped().First(&trashed, trashed.OwnershipUID)
+	db.DB.First(&location, location.LocationUID)
+	db.DB.First(&borrower, borrower.BorrowerUID)
+	if ownership.ItemOwner != owner.UserUID || trashed.ItemOwner != owner.UserUID {
+		t.Errorf("ownerships belong to %d and %d, want the household owner %d", ownership.ItemOwner, trashed.ItemOwner, owner.UserUID)
+	}
+	if location.LocationOwner != owner.UserUID {
+		t.Errorf("location belongs to %d, want the household owner %d", location.LocationOwner, owner.UserUID)
+	}
+	if borrower.BorrowerOwner != owner.UserUID {
+		t.Errorf("borrower belongs to %d, want the household owner %d", borrower.BorrowerOwner, owner.UserUID)
+	}
+
+	// The history still credits the member
+	if err := db.DB.First(&event, event.EventUID).Error; err != nil || event.Actor != member.UserUID {
+		t.Errorf("the members ownership event was not kept: %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// The UID of the seeded item that ownerships of deleted items are moved to.
+const defaultItemUID = 1
+
+// The default and maximum number of rows returned per page.
+const defaultPageSize = 50
+const maxPageSize = 200
+
+/*
+* Returns a 403 response for a disabled account.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The c.Status being returned via fiber.
+ */
+func accountDisabledError(c *fiber.Ctx) error {
+	return Error(c, 403, "Account has been disabled", DTO("reason", "account_disabled"))
+}
+
+/*
+* Reads the page and pageSize query parameters.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return int The page, starting at 1.
+* @return int The number of rows per page.
+ */
+func pageParams(c *fiber.Ctx) (int, int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.Query("pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize
+}
+
+/*
+* Lists users, optionally filtered by a search on username or email.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminUsers(c *fiber.Ctx) error {
+	// Initialize variables
+	search := c.Query("search")
+	page, pageSize := pageParams(c)
+
+	query := db.DB.Model(&models.User{})
+	if search != "" {
+		query = query.Where("username LIKE ? OR email LIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var users []models.User
+	if err := query.Order("user_uid").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		return Error(c, 500, "There was an error retrieving users")
+	}
+
+	usersDTO := DTO("users", users)
+	totalDTO := DTO("total", total)
+	pageDTO := DTO("page", page)
+	return Success(c, "Users returned", usersDTO, totalDTO, pageDTO)
+}
+
+/*
+* Returns a single user with their tier and current usage.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminUser(c *fiber.Ctx) error {
+	// Validate user
+	var user models.User
+	result := db.DB.Where("user_uid = ?", c.Query("userUID")).First(&user)
+	code, err := RecordExists("User", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	userDTO := DTO("user", user)
+	tierDTO := DTO("tier", userTier(user))
+	usageDTO := DTO("usage", tierUsage(user))
+	return Success(c, "User returned", userDTO, tierDTO, usageDTO)
+}
+
+/*
+* Disables or re-enables a user account. Disabling an account ends all of its sessions.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminUserDisable(c *fiber.Ctx) error {
+	// Initialize variables
+	admin := c.Locals("user").(models.User)
+	disabled, err := strconv.ParseBool(c.Query("disabled", "true"))
+	if err != nil {
+		return Error(c, 400, "Disabled must be true or false")
+	}
+
+	// Validate user
+	var user models.User
+	result := db.DB.Where("user_uid = ?", c.Query("userUID")).First(&user)
+	code, err := RecordExists("User", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if user.UserUID == admin.UserUID {
+		return Error(c, 400, "Cannot disable your own account")
+	}
+
+	db.DB.Model(&user).Update("disabled", disabled)
+	if disabled {
+		revokeUserSessions(user.UserUID, 0)
+		log.Printf("controller#AdminUserDisable: User %d was disabled by admin %d", user.UserUID, admin.UserUID)
+		return Success(c, "User was disabled")
+	}
+
+	log.Printf("controller#AdminUserDisable: User %d was enabled by admin %d", user.UserUID, admin.UserUID)
+	return Success(c, "User was enabled")
+}
+
+/*
+* Sets the tier of a user. An empty tier resets the user to DEFAULT_TIER.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminUserTier(c *fiber.Ctx) error {
+	// Initialize variables
+	tierName := c.Query("tier")
+	if _, ok := models.Tiers[tierName]; tierName != "" && !ok {
+		return Error(c, 400, "Tier does not exist")
+	}
+
+	// Validate user
+	var user models.User
+	result := db.DB.Where("user_uid = ?", c.Query("userUID")).First(&user)
+	code, err := RecordExists("User", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	db.DB.Model(&user).Update("tier", tierName)
+	user.Tier = tierName
+
+	tierDTO := DTO("tier", userTier(user))
+	return Success(c, "Tier was updated", tierDTO)
+}
+
+/*
+* Returns statistics about the global item catalog.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminItemStats(c *fiber.Ctx) error {
+	var stats models.ItemStatsDTO
+
+	db.DB.Model(&models.Item{}).Count(&stats.Items)
+	db.DB.Model(&models.Ownership{}).Count(&stats.Ownerships)
+	db.DB.Model(&models.Ownership{}).Distinct("item_number").Count(&stats.OwnedItems)
+	db.DB.Model(&models.Item{}).Where("item_name = '' OR item_brand = '' OR item_img = ''").Count(&stats.IncompleteItems)
+	stats.UnownedItems = stats.Items - stats.OwnedItems
+
+	stats.TopItems = []models.ItemUsageDTO{}
+	db.DB.Model(&models.Item{}).
+		Select("items.item_uid, items.barcode, items.item_name AS name, COUNT(ownerships.ownership_uid) AS ownerships").
+		Joins("JOIN ownerships ON ownerships.item_number = items.item_uid").
+		Where("items.item_uid <> ?", defaultItemUID).
+		Group("items.item_uid, items.barcode, items.item_name").
+		Order("ownerships DESC").
+		Limit(10).
+		Scan(&stats.TopItems)
+
+	statsDTO := DTO("stats", stats)
+	return Success(c, "Item statistics returned", statsDTO)
+}
+
+/*
+* Lists items, optionally filtered by a search on barcode, name or brand.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminItems(c *fiber.Ctx) error {
+	// Initialize variables
+	search := c.Query("search")
+	page, pageSize := pageParams(c)
+
+	query := db.DB.Model(&models.Item{})
+	if search != "" {
+		query = query.Where("barcode LIKE ? OR item_name LIKE ? OR item_brand LIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var items []models.Item
+	if err := query.Order("item_uid").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+		return Error(c, 500, "There was an error retrieving items")
+	}
+
+	itemsDTO := DTO("items", items)
+	totalDTO := DTO("total", total)
+	pageDTO := DTO("page", page)
+	return Success(c, "Items returned", itemsDTO, totalDTO, pageDTO)
+}
+
+/*
+* Edits the fields of an item in the global catalog. Fields that are left empty are not changed.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminItemEdit(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Validate item
+	var item models.Item
+	result := db.DB.Where("item_uid = ?", c.Query("itemUID")).First(&item)
+	code, err := RecordExists("Item", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Check the barcode is not used by another item
+	if data["barcode"] != "" && data["barcode"] != item.Barcode {
+		var existing models.Item
+		result = db.DB.Where("barcode = ?", data["barcode"]).First(&existing)
+		code, err = recordNotInUse("Barcode", result)
+		if err != nil {
+			return Error(c, code, err.Error())
+		}
+		item.Barcode = data["barcode"]
+	}
+
+	// Add new fields
+	if data["itemName"] != "" {
+		item.Name = data["itemName"]
+	}
+	if data["itemBrand"] != "" {
+		item.Brand = data["itemBrand"]
+	}
+	if data["itemImage"] != "" {
+		item.Image = data["itemImage"]
+	}
+
+	db.DB.Save(&item)
+
+	itemDTO := DTO("item", item)
+	return Success(c, "Item was successfully updated", itemDTO)
+}
+
+/*
+* Deletes an item from the global catalog. Ownerships of the item are moved to the default item.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AdminItemDelete(c *fiber.Ctx) error {
+	// Validate item
+	var item models.Item
+	result := db.DB.Where("item_uid = ?", c.Query("itemUID")).First(&item)
+	code, err := RecordExists("Item", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if item.ItemUid == defaultItemUID {
+		return Error(c, 400, "The default item cannot be deleted")
+	}
+
+	var moved int64
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Keep the item name on ownerships that did not have a custom name, including those in the trash
+		result := tx.Unscoped().Model(&models.Ownership{}).Where("item_number = ?", item.ItemUid).Updates(map[string]interface{}{
+			"item_number":      defaultItemUID,
+			"custom_item_name": gorm.Expr("COALESCE(NULLIF(custom_item_name, ''), ?)", item.Name),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error deleting the item")
+	}
+
+	movedDTO := DTO("ownershipsMoved", moved)
+	return Success(c, "Item was successfully deleted", movedDTO)
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The longest string value stored in full in the audit log.
+const maxAuditValueLength = 512
+
+/*
+* Flattens a record into its JSON fields, leaving out preloaded relations.
+*
+* @param record The record, e.g. a models.Ownership.
+*
+* @return map[string]interface{} The fields of the record, nil if there is no record.
+ */
+func auditSnapshot(record interface{}) map[string]interface{} {
+	if record == nil {
+		return nil
+	}
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if json.Unmarshal(raw, &fields) != nil {
+		return nil
+	}
+	for key, value := range fields {
+		if _, nested := value.(map[string]interface{}); nested {
+			delete(fields, key)
+		}
+		// Large values such as images are only recorded by size
+		if text, ok := value.(string); ok && len(text) > maxAuditValueLength {
+			fields[key] = fmt.Sprintf("<%d bytes>", len(text))
+		}
+	}
+	return fields
+}
+
+/*
+* Builds the before and after JSON of a change, keeping only the fields that changed.
+*
+* @param before The record before the change, nil when it was created.
+* @param after The record after the change, nil when it was deleted.
+*
+* @return json.RawMessage The changed fields before the change.
+* @return json.RawMessage The changed fields after the change.
+ */
+func auditDiff(before interface{}, after interface{}) (json.RawMessage, json.RawMessage) {
+	beforeFields := auditSnapshot(before)
+	afterFields := auditSnapshot(after)
+
+	if beforeFields != nil && afterFields != nil {
+		for key, value := range beforeFields {
+			if reflect.DeepEqual(value, afterFields[key]) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	beforeJSON, _ := json.Marshal(beforeFields)
+	afterJSON, _ := json.Marshal(afterFields)
+	return beforeJSON, afterJSON
+}
+
+/*
+* Appends an entry to the audit log. Failing to write the entry is logged but does not fail the request.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param householdUID The UID of the household the change was made in.
+* @param action The action taken, e.g. "ownership.quantity".
+* @param entityType The type of the changed record, e.g. "ownership".
+* @param entityID The UID of the changed record.
+* @param before The record before the change, nil when it was created.
+* @param after The record after the change, nil when it was deleted.
+ */
+func recordAudit(c *fiber.Ctx, householdUID uint, action string, entityType string, entityID uint, before interface{}, after interface{}) {
+	user, _ := c.Locals("user").(models.User)
+	appendAudit(householdUID, user.UserUID, action, entityType, entityID, before, after)
+}
+
+/*
+* Appends an entry to the audit log for a given actor, used directly by changes made outside of a request.
+*
+* @param householdUID The UID of the household the change was made in.
+* @param actor The UID of the user who made the change, 0 for the server itself.
+* @param action The action taken, e.g. "ownership.purge".
+* @param entityType The type of the changed record, e.g. "ownership".
+* @param entityID The UID of the changed record.
+* @param before The record before the change, nil when it was created.
+* @param after The record after the change, nil when it was deleted.
+ */
+func appendAudit(householdUID uint, actor uint, action string, entityType string, entityID uint, before interface{}, after interface{}) {
+	beforeJSON, afterJSON := auditDiff(before, after)
+
+	entry := models.AuditLog{
+		AuditHousehold: householdUID,
+		Actor:          actor,
+		Action:         action,
+		EntityType:     entityType,
+		EntityID:       entityID,
+		Before:         beforeJSON,
+		After:          afterJSON,
+	}
+	if err := db.DB.Create(&entry).Error; err != nil {
+		log.Printf("controller#appendAudit: Error recording %s of %s %d: %v", action, entityType, entityID, err)
+	}
+}
+
+/*
+* Returns the audit log of the household, newest first.
+* Can be filtered by entityType, entityID, actor and action.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func AuditList(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionView) {
+		return permissionError(c, permissionView)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+	page, pageSize := pageParams(c)
+
+	query := db.DB.Model(&models.AuditLog{}).Where("audit_household = ?", household.HouseholdUID)
+	filters := map[string]string{
+		"entity_type = ?": c.Query("entityType"),
+		"entity_id = ?":   c.Query("entityID"),
+		"actor = ?":       c.Query("actor"),
+		"action = ?":      c.Query("action"),
+	}
+	for condition, value := range filters {
+		if value != "" {
+			query = query.Where(condition, value)
+		}
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AuditLog
+	if err := query.Order("audit_uid DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		return Error(c, 500, "There was an error retrieving the audit log")
+	}
+
+	entriesDTO := DTO("entries", entries)
+	totalDTO := DTO("total", total)
+	pageDTO := DTO("page", page)
+	return Success(c, "Audit log returned", entriesDTO, totalDTO, pageDTO)
+}
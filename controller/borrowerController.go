@@ -16,16 +16,29 @@ import (
 * @return error The error message, if there is any.
  */
 func CreateBorrower(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
 	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	borrowerName := c.Query("borrower")
 
 	// Check for empty fields
 	if borrowerName == "" {return Error(c, 400, "The borrower field is empty")}
 
+	// Enforce the borrower limit of the users tier
+	owner := householdOwner(household)
+	tier := userTier(owner)
+	if !withinQuota(tier.MaxBorrowers, borrowerCount(owner), 1) {
+		return quotaExceeded(c, "borrowers", tier.MaxBorrowers)
+	}
+
 	// Validate location QR code is not in use
 	var borrower models.Borrower
-	result := db.DB.Where("borrower_name = ? AND borrower_owner = ?", borrowerName, user.UserUID).First(&borrower)
+	result := db.DB.Where("borrower_name = ? AND borrower_household = ?", borrowerName, household.HouseholdUID).First(&borrower)
 	code, err := recordNotInUse("Borrower Name", result)
 	if err != nil {return Error(c, code, err.Error())}
 
@@ -33,9 +46,11 @@ func CreateBorrower(c *fiber.Ctx) error {
 	borrower = models.Borrower{
 		BorrowerName:  borrowerName,
 		BorrowerOwner: user.UserUID,
+		BorrowerHousehold: household.HouseholdUID,
 	}
 
 	db.DB.Create(&borrower)
+	recordAudit(c, household.HouseholdUID, "borrower.create", "borrower", borrower.BorrowerUID, nil, borrower)
 
 	borrowerDTO := DTO("borrower", borrower)
 
@@ -50,8 +65,14 @@ func CreateBorrower(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
 */
 func CheckoutItem(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionBorrow)
+	if !allowed {
+		return permissionError(c, permissionBorrow)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	var request BorrowerRequest
 	borrowerUID, err := strconv.ParseUint(c.Query("borrowerUID"), 10, 64)
 
@@ -63,12 +84,12 @@ func CheckoutItem(c *fiber.Ctx) error {
 	if err != nil {return Error(c, 400, "There was an error parsing JSON")}
 
 	var borrower models.Borrower
-	var userUID = user.UserUID
+	var householdUID = household.HouseholdUID
 	if (borrowerUID == 2){	
-		userUID = 0
+		householdUID = 0
 	}
 
-	result := db.DB.Where("borrower_uid = ? AND borrower_owner = ?", borrowerUID, userUID).First(&borrower)
+	result := db.DB.Where("borrower_uid = ? AND borrower_household = ?", borrowerUID, householdUID).First(&borrower)
 	
 	code, err := RecordExists("Borrower UID", result)
 	if err != nil {return Error(c, code, err.Error())}
@@ -78,12 +99,21 @@ func CheckoutItem(c *fiber.Ctx) error {
 
 	for _, ownership := range request.Ownerships {		
 		var item models.Ownership
-		result = db.DB.Where("ownership_uid = ? AND item_owner = ?", ownership, user.UserUID).First(&item)
+		query := db.DB.Where("ownership_uid = ? AND item_household = ?", ownership, household.HouseholdUID)
+		if limited {
+			query = query.Where("item_location IN ?", scope)
+		}
+		result = query.First(&item)
 		
 		_, err := RecordExists("Ownership", result)
 		if err == nil {
+			before := item
 			item.ItemBorrower = uint(borrowerUID)
 			db.DB.Save(&item)
+			recordAudit(c, household.HouseholdUID, "ownership.checkout", "ownership", item.OwnershipUID, before, item)
+			if before.ItemBorrower != item.ItemBorrower {
+				recordOwnershipEvent(c, item, models.OwnershipCheckedOut, "Checked out to "+borrower.BorrowerName, "", borrower.BorrowerName)
+			}
 			preloadOwnership(&item)
 			successfulOwnerships = append(successfulOwnerships, ownership)
 			success++
@@ -107,8 +137,14 @@ func CheckoutItem(c *fiber.Ctx) error {
 */
 
 func CheckinItem(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionBorrow)
+	if !allowed {
+		return permissionError(c, permissionBorrow)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	var request BorrowerRequest
 
 	err := c.BodyParser(&request)
@@ -119,12 +155,22 @@ func CheckinItem(c *fiber.Ctx) error {
 
 	for _, ownership := range request.Ownerships {		
 		var item models.Ownership
-		result := db.DB.Where("ownership_uid = ? AND item_owner = ?", ownership, user.UserUID).First(&item)
+		query := db.DB.Where("ownership_uid = ? AND item_household = ?", ownership, household.HouseholdUID)
+		if limited {
+			query = query.Where("item_location IN ?", scope)
+		}
+		result := query.First(&item)
 		
 		_, err := RecordExists("Ownership", result)
 		if err == nil {
+			before := item
 			item.ItemBorrower = uint(1)
 			db.DB.Save(&item)
+			recordAudit(c, household.HouseholdUID, "ownership.checkin", "ownership", item.OwnershipUID, before, item)
+			if before.ItemBorrower != item.ItemBorrower {
+				returnedBy := borrowerName(before.ItemBorrower)
+				recordOwnershipEvent(c, item, models.OwnershipCheckedIn, "Returned by "+returnedBy, returnedBy, "")
+			}
 			preloadOwnership(&item)
 			successfulOwnerships = append(successfulOwnerships, ownership)
 			success++
@@ -148,12 +194,17 @@ func CheckinItem(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
 */
 func GetBorrowers(c *fiber.Ctx) error{
+	// Check the users household role
+	if !hasPermission(c, permissionView) {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 
 	// Get borrower	
 	var borrowers []models.Borrower
-	db.DB.Where("borrower_owner = ?", user.UserUID).Find(&borrowers)
+	db.DB.Where("borrower_household = ?", household.HouseholdUID).Find(&borrowers)
 
 	if len(borrowers) == 0 {
 		return Success(c, "No borrowers found")
@@ -165,14 +216,19 @@ func GetBorrowers(c *fiber.Ctx) error{
 }
 
 func GetCheckedOutItems(c *fiber.Ctx) error{
+	// Check the users household role
+	if !hasPermission(c, permissionView) {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	var ownerships []models.Ownership
 	var checkedOut []models.CheckedOutDTO
 
 	// Get borrower	
 	var borrowers []models.Borrower
-	db.DB.Where("borrower_owner = ?", user.UserUID).Find(&borrowers)
+	db.DB.Where("borrower_household = ?", household.HouseholdUID).Find(&borrowers)
 
 	if len(borrowers) == 0 {
 		return Success(c, "No borrowers found")
@@ -180,14 +236,12 @@ func GetCheckedOutItems(c *fiber.Ctx) error{
 
 	for b := range borrowers{
 		ownerships = nil
-		query := db.DB.Where("item_owner = ? AND item_borrower = ?", user.UserUID, borrowers[b].BorrowerUID)
+		query := db.DB.Where("item_household = ? AND item_borrower = ?", household.HouseholdUID, borrowers[b].BorrowerUID)
 		
 		if err := query.Find(&ownerships).Error; err != nil{
 			continue
 		}	
-		for o := range ownerships {
-			preloadOwnership(&ownerships[o])
-		}
+		preloadOwnerships(ownerships)
 		borrower := CheckedOutDto(borrowers[b], ownerships)
 		if len(ownerships) != 0 {
 			checkedOut = append(checkedOut, borrower)
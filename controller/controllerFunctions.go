@@ -57,18 +57,20 @@ func recordNotInUse(field string, result *gorm.DB) (int, error) {
 * Creates an ownership relationship between a user and an item.
 *
 * @param uid The users UID.
+* @param householdUID The UID of the household the ownership belongs to.
 * @param itemUid The items UID.
 *
 * @return models.Ownership The ownership model.
 * @return error The error message, if there is one.
  */
-func createOwnership(uid uint, item models.Item, qr string, customName string) (models.Ownership, error) {
+func createOwnership(uid uint, householdUID uint, item models.Item, qr string, customName string) (models.Ownership, error) {
 	if customName == "" {
 		customName = item.Name
 	}
 
 	ownership := models.Ownership{
 		ItemOwner:  uid,
+		ItemHousehold: householdUID,
 		ItemNumber: item.ItemUid,
 		ItemQuantity: 1,
 		ItemQR: qr,
@@ -116,14 +118,21 @@ func Success(c *fiber.Ctx, message string, dtos ...models.DTO) error {
 * @param c The fiber context containing the HTTP request and response objects.
 * @param code The error code to return via fiber.
 * @param message The error message to return via fiber.
+* @param dtos Any extra fields to be added to the response map.
 *
 * @return error The c.Status being returned via fiber.
  */
-func Error(c *fiber.Ctx, code int, message string) error {
-	log.Printf("%s: Status Code: %d, Response: %v", utils.CallerFunctionName(2), code, fiber.Map{"message": message})
-	return c.Status(code).JSON(fiber.Map{
+func Error(c *fiber.Ctx, code int, message string, dtos ...models.DTO) error {
+	responseMap := fiber.Map{
 		"message": message,
-		"success": false})
+		"success": false}
+
+	for _, dto := range dtos {
+		responseMap[dto.Name] = dto.Data
+	}
+
+	log.Printf("%s: Status Code: %d, Response: %v", utils.CallerFunctionName(2), code, responseMap)
+	return c.Status(code).JSON(responseMap)
 }
 
 /*
@@ -153,35 +162,28 @@ func preloadOwnership(ownership *models.Ownership) {
 }
 
 /*
-* Preloads the Locations foreignkey structs
+* Preloads the Locations foreignkey structs, its parents and its breadcrumb from the closure table
 *
 * @param location The location to preload.
  */
 func preloadLocation(location *models.Location) {
-	db.DB.Preload("User").Preload("Location").Find(&location)
-
-	// Recursively preload the parent's hierarchy
-	if location.Parent != nil && location.Location.LocationUID != 1 {
-		preloadLocation(location.Location)
-	}
+	preloadLocations([]*models.Location{location})
 }
 
 /*
 * Returns the ownerships and locations inside of a parent location.
 *
 * @param location The location
-* @param user The user making the call
+* @param household The household the call is made in
 */
-func GetAllFromLocation(location models.Location, user models.User) ([]models.Ownership, []models.Location) {
+func GetAllFromLocation(location models.Location, household models.Household) ([]models.Ownership, []models.Location) {
 	// search and get all ownerships from location
 	var ownerships []models.Ownership
-	db.DB.Where("item_location = ? AND item_owner = ?", location.LocationUID, user.UserUID).Find(&ownerships)	
+	db.DB.Where("item_location = ? AND item_household = ?", location.LocationUID, household.HouseholdUID).Find(&ownerships)	
 
 	// search and get all locations from parent location
 	var locations []models.Location
-	db.DB.Where("location_parent = ? AND location_owner = ?", location.LocationUID, user.UserUID).Find(&locations)
-
-	// TODO recursion?
+	db.DB.Where("location_parent = ? AND location_household = ?", location.LocationUID, household.HouseholdUID).Find(&locations)
 
 	return ownerships, locations
 }
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+/*
+* Creates a user with a personal household for a test.
+*
+* @param t The test.
+* @param username The username.
+*
+* @return models.User The user.
+* @return models.Household The users personal household.
+ */
+func testUser(t *testing.T, username string) (models.User, models.Household) {
+	t.Helper()
+
+	user := models.User{Username: username, Email: username + "@example.com"}
+	var household models.Household
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		var err error
+		household, err = createHousehold(tx, user, username+"'s household")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Creating user %s failed: %v", username, err)
+	}
+	return user, household
+}
+
+/*
+* Calls a handler as a member of a household, the way it is called after the ResolveHousehold middleware.
+*
+* @param t The test.
+* @param handler The handler.
+* @param user The user making the request.
+* @param membership The users membership of the household the request works in.
+* @param method The HTTP method.
+* @param target The path and query of the request.
+* @param body The JSON body, if there is one.
+*
+* @return int The status code of the response.
+* @return map[string]interface{} The decoded response.
+ */
+func testRequest(t *testing.T, handler fiber.Handler, user models.User, membership models.Membership, method string, target string, body string) (int, map[string]interface{}) {
+	t.Helper()
+
+	var household models.Household
+	db.DB.Where("household_uid = ?", membership.Household).First(&household)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", user)
+		c.Locals("household", household)
+		c.Locals("membership", membership)
+		return c.Next()
+	})
+	app.All("/*", handler)
+
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	response, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&decoded)
+	return response.StatusCode, decoded
+}
@@ -0,0 +1,662 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/mailer"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+/*
+* Creates a household with the user as its owner.
+*
+* @param tx The database connection or transaction to create the household with.
+* @param user The user creating the household.
+* @param name The name of the household.
+*
+* @return models.Household The new household.
+* @return error The error message, if there is one.
+ */
+func createHousehold(tx *gorm.DB, user models.User, name string) (models.Household, error) {
+	household := models.Household{HouseholdName: name, HouseholdOwner: user.UserUID}
+	if err := tx.Create(&household).Error; err != nil {
+		return household, err
+	}
+
+	membership := models.Membership{
+		Household:  household.HouseholdUID,
+		MemberUser: user.UserUID,
+		MemberRole: models.HouseholdOwner,
+		JoinedAt:   time.Now(),
+	}
+	return household, tx.Create(&membership).Error
+}
+
+/*
+* Permanently deletes a household along with its ownerships and their history, locations, borrowers, grants, memberships and invitations.
+*
+* @param tx The transaction to delete the records in.
+* @param householdUID The households UID.
+*
+* @return error The error message, if there is one.
+ */
+func deleteHouseholdData(tx *gorm.DB, householdUID uint) error {
+	// Records are deleted before the ones they reference
+	deletes := []struct {
+		query string
+		model interface{}
+	}{
+		{"grant_household = ?", &models.LocationGrant{}},
+		{"event_household = ?", &models.OwnershipEvent{}},
+		{"closure_household = ?", &models.LocationClosure{}},
+		{"household = ?", &models.HouseholdInvitation{}},
+		{"item_household = ?", &models.Ownership{}},
+		{"location_household = ?", &models.Location{}},
+		{"borrower_household = ?", &models.Borrower{}},
+		{"household = ?", &models.Membership{}},
+		{"household_uid = ?", &models.Household{}},
+	}
+
+	for _, d := range deletes {
+		// Nested locations reference each other, so they are detached before being deleted
+		if _, ok := d.model.(*models.Location); ok {
+			if err := tx.Unscoped().Model(&models.Location{}).Where(d.query, householdUID).Update("location_parent", nil).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where(d.query, householdUID).Delete(d.model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+* Removes a user from every household they belong to and revokes the locations shared with them.
+* Households the user owns are handed to their longest standing member, or deleted when nobody else is left.
+*
+* @param tx The transaction to make the changes in.
+* @param uid The users UID.
+*
+* @return error The error message, if there is one.
+ */
+func leaveHouseholds(tx *gorm.DB, uid uint) error {
+	var memberships []models.Membership
+	if err := tx.Where("member_user = ?", uid).Find(&memberships).Error; err != nil {
+		return err
+	}
+
+	for _, membership := range memberships {
+		if membership.MemberRole == models.HouseholdOwner {
+			var successor models.Membership
+			result := tx.Where("household = ? AND member_user <> ?", membership.Household, uid).Order("joined_at").First(&successor)
+			if result.Error == gorm.ErrRecordNotFound {
+				if err := deleteHouseholdData(tx, membership.Household); err != nil {
+					return err
+				}
+				continue
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+			if err := transferHousehold(tx, membership.Household, successor); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&membership).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("grant_user = ?", uid).Delete(&models.LocationGrant{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("invitee_user = ?", uid).Delete(&models.HouseholdInvitation{}).Error
+}
+
+/*
+* Hands the ownerships, locations and borrowers a user created to the owners of the households they are in,
+* so they stay with the household when the user is deleted. Records in the trash are handed over as well.
+*
+* @param tx The transaction to make the changes in.
+* @param uid The users UID.
+*
+* @return error The error message, if there is one.
+ */
+func reassignUserRecords(tx *gorm.DB, uid uint) error {
+	updates := []struct {
+		model     interface{}
+		owner     string
+		household string
+	}{
+		{&models.Ownership{}, "item_owner", "ownerships.item_household"},
+		{&models.Location{}, "location_owner", "locations.location_household"},
+		{&models.Borrower{}, "borrower_owner", "borrowers.borrower_household"},
+	}
+
+	for _, u := range updates {
+		owner := gorm.Expr("COALESCE((SELECT household_owner FROM households WHERE households.household_uid = " + u.household + "), 1)")
+		if err := tx.Unscoped().Model(u.model).Where(u.owner+" = ?", uid).Update(u.owner, owner).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+* Makes a member the owner of a household.
+*
+* @param tx The transaction to make the changes in.
+* @param householdUID The households UID.
+* @param successor The membership of the new owner.
+*
+* @return error The error message, if there is one.
+ */
+func transferHousehold(tx *gorm.DB, householdUID uint, successor models.Membership) error {
+	err := tx.Model(&models.Membership{}).Where("household = ? AND member_role = ?", householdUID, models.HouseholdOwner).
+		Update("member_role", models.HouseholdEditor).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&successor).Update("member_role", models.HouseholdOwner).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Household{}).Where("household_uid = ?", householdUID).Update("household_owner", successor.MemberUser).Error
+}
+
+/*
+* Retrieves a household and the users membership of it.
+*
+* @param user The user.
+* @param householdUID The households UID.
+*
+* @return models.Household The household.
+* @return models.Membership The users membership.
+* @return int The HTTP error code to return.
+* @return error The error message, if there is one.
+ */
+func memberHousehold(user models.User, householdUID string) (models.Household, models.Membership, int, error) {
+	var household models.Household
+	var membership models.Membership
+
+	result := db.DB.Where("household = ? AND member_user = ?", householdUID, user.UserUID).First(&membership)
+	code, err := RecordExists("Household", result)
+	if err != nil {
+		return household, membership, code, err
+	}
+
+	result = db.DB.Where("household_uid = ?", membership.Household).First(&household)
+	code, err = RecordExists("Household", result)
+	return household, membership, code, err
+}
+
+/*
+* Returns the households the user belongs to, along with their role in each.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdList(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	var memberships []models.Membership
+	db.DB.Where("member_user = ?", user.UserUID).Order("joined_at").Find(&memberships)
+
+	households := []fiber.Map{}
+	for _, membership := range memberships {
+		var household models.Household
+		if db.DB.Where("household_uid = ?", membership.Household).First(&household).Error != nil {
+			continue
+		}
+		households = append(households, fiber.Map{"household": household, "role": membership.MemberRole})
+	}
+
+	householdsDTO := DTO("households", households)
+	return Success(c, "Households returned", householdsDTO)
+}
+
+/*
+* Creates a new household with the user as its owner.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdCreate(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	name := strings.TrimSpace(c.Query("name"))
+
+	// Check for empty fields
+	if name == "" {
+		return Error(c, 400, "Name is empty and required")
+	}
+
+	var household models.Household
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		household, err = createHousehold(tx, user, name)
+		return err
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error creating the household")
+	}
+
+	householdDTO := DTO("household", household)
+	return Success(c, "Household was successfully created", householdDTO)
+}
+
+/*
+* Renames a household.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdEdit(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	name := strings.TrimSpace(c.Query("name"))
+
+	// Check for empty fields
+	if name == "" {
+		return Error(c, 400, "Name is empty and required")
+	}
+
+	household, membership, code, err := memberHousehold(user, c.Query("householdUID"))
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if !rolePermits(membership.MemberRole, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	before := household
+	household.HouseholdName = name
+	db.DB.Save(&household)
+	recordAudit(c, household.HouseholdUID, "household.edit", "household", household.HouseholdUID, before, household)
+
+	return Success(c, "Household was successfully updated")
+}
+
+/*
+* Deletes a household and everything in it. The users last household cannot be deleted.
+* Members that belong to no other household are given a new personal household.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdDelete(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	household, membership, code, err := memberHousehold(user, c.Query("householdUID"))
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if !rolePermits(membership.MemberRole, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	var count int64
+	db.DB.Model(&models.Membership{}).Where("member_user = ?", user.UserUID).Count(&count)
+	if count <= 1 {
+		return Error(c, 400, "Cannot delete your only household")
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var stranded []models.User
+		members := tx.Model(&models.Membership{}).Select("member_user").Where("household = ? AND member_user <> ?", household.HouseholdUID, user.UserUID)
+		elsewhere := tx.Model(&models.Membership{}).Select("member_user").Where("household <> ?", household.HouseholdUID)
+		if err := tx.Where("user_uid IN (?) AND user_uid NOT IN (?)", members, elsewhere).Find(&stranded).Error; err != nil {
+			return err
+		}
+		for _, member := range stranded {
+			if _, err := createHousehold(tx, member, member.Username+"'s household"); err != nil {
+				return err
+			}
+		}
+
+		return deleteHouseholdData(tx, household.HouseholdUID)
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error deleting the household")
+	}
+
+	return Success(c, "Household was successfully deleted")
+}
+
+/*
+* Returns the members of a household.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdMembers(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	household, _, code, err := memberHousehold(user, c.Query("householdUID"))
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	var members []models.Membership
+	db.DB.Preload("User").Where("household = ?", household.HouseholdUID).Order("joined_at").Find(&members)
+
+	membersDTO := DTO("members", members)
+	return Success(c, "Members returned", membersDTO)
+}
+
+/*
+* Removes a member from a household. Only the owner can remove other members.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdRemoveMember(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	household, membership, code, err := memberHousehold(user, c.Query("householdUID"))
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if !rolePermits(membership.MemberRole, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	var member models.Membership
+	result := db.DB.Where("household = ? AND member_user = ?", household.HouseholdUID, c.Query("userUID")).First(&member)
+	code, err = RecordExists("Member", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if member.MemberUser == user.UserUID {
+		return Error(c, 400, "The owner cannot be removed from the household")
+	}
+
+	db.DB.Delete(&member)
+	recordAudit(c, household.HouseholdUID, "membership.remove", "membership", member.MembershipUID, member, nil)
+
+	return Success(c, "Member was successfully removed")
+}
+
+/*
+* Changes the role of a member. Giving a member the owner role hands the household over to them.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdMemberRole(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	role := c.Query("role")
+
+	if _, ok := rolePermissions[role]; !ok {
+		return Error(c, 400, "Role must be owner, editor, viewer or borrow-only")
+	}
+
+	household, membership, code, err := memberHousehold(user, c.Query("householdUID"))
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if !rolePermits(membership.MemberRole, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	var member models.Membership
+	result := db.DB.Where("household = ? AND member_user = ?", household.HouseholdUID, c.Query("userUID")).First(&member)
+	code, err = RecordExists("Member", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if member.MemberRole == models.HouseholdOwner {
+		return Error(c, 400, "The owner's role can only change by handing the household to another member")
+	}
+
+	if role == models.HouseholdOwner {
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			return transferHousehold(tx, household.HouseholdUID, member)
+		})
+	} else {
+		err = db.DB.Model(&member).Update("member_role", role).Error
+	}
+	if err != nil {
+		return Error(c, 500, "There was an error changing the role")
+	}
+	after := member
+	after.MemberRole = role
+	recordAudit(c, household.HouseholdUID, "membership.role", "membership", member.MembershipUID, member, after)
+
+	return Success(c, "Role was successfully changed")
+}
+
+/*
+* Leaves a household. The owner has to delete the household instead.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdLeave(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	_, membership, code, err := memberHousehold(user, c.Query("householdUID"))
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if membership.MemberRole == models.HouseholdOwner {
+		return Error(c, 400, "The owner cannot leave the household")
+	}
+
+	db.DB.Delete(&membership)
+	recordAudit(c, membership.Household, "membership.leave", "membership", membership.MembershipUID, membership, nil)
+
+	return Success(c, "Left the household")
+}
+
+/*
+* Invites a user to a household by username or email address, with the role they will join as.
+* Email addresses without an account receive an invitation they can accept after signing up.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdInvite(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["username"] == "" && data["email"] == "" {
+		return Error(c, 400, "Username or email is empty and required")
+	}
+	role := data["role"]
+	if role == "" {
+		role = models.HouseholdEditor
+	}
+	if _, ok := rolePermissions[role]; !ok || role == models.HouseholdOwner {
+		return Error(c, 400, "Role must be editor, viewer or borrow-only")
+	}
+
+	household, membership, code, err := memberHousehold(user, c.Query("householdUID"))
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if !rolePermits(membership.MemberRole, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	// Resolve the invitee, an unknown username is an error but an unknown email is invited by address.
+	// The response is the same whether or not an email belongs to an account, and the address of an account is never returned.
+	var invitee models.User
+	if data["username"] != "" {
+		result := db.DB.Where("username = ?", data["username"]).First(&invitee)
+		code, err := RecordExists("Username", result)
+		if err != nil {
+			return Error(c, code, err.Error())
+		}
+	} else {
+		if !emailRegex.MatchString(data["email"]) {
+			return Error(c, 400, "Email does not match requirements")
+		}
+		db.DB.Where("email = ?", data["email"]).First(&invitee)
+	}
+
+	invitation := models.HouseholdInvitation{
+		Household:    household.HouseholdUID,
+		InvitedBy:    user.UserUID,
+		InviteeUser:  invitee.UserUID,
+		InviteeEmail: data["email"],
+		InviteeRole:  role,
+		ExpiresAt:    time.Now().Add(utils.EnvDuration("HOUSEHOLD_INVITATION_LIFETIME", 7*24*time.Hour)),
+	}
+	recipient := invitation.InviteeEmail
+	if data["username"] != "" {
+		invitation.InviteeEmail = ""
+		recipient = invitee.Email
+
+		var existing models.Membership
+		result := db.DB.Where("household = ? AND member_user = ?", household.HouseholdUID, invitee.UserUID).First(&existing)
+		if result.Error == nil {
+			return Error(c, 400, "User is already a member of the household")
+		}
+	}
+
+	if err := db.DB.Create(&invitation).Error; err != nil {
+		return Error(c, 500, "There was an error creating the invitation")
+	}
+	recordAudit(c, household.HouseholdUID, "invitation.create", "invitation", invitation.InvitationUID, nil, invitation)
+
+	if recipient != "" {
+		body := "Hi,\n\n" + user.Username + " invited you to join their WIG household \"" + household.HouseholdName + "\".\n\n" +
+			"Open WIG to accept the invitation. If you do not have an account yet, sign up with this email address first."
+		if err := mailer.Send(recipient, "You were invited to a WIG household", body); err != nil {
+			log.Printf("controller#HouseholdInvite: Error sending invitation email: %v", err)
+		}
+	}
+
+	invitationDTO := DTO("invitation", invitation)
+	return Success(c, "Invitation was sent", invitationDTO)
+}
+
+/*
+* Builds the query for the pending invitations of a user.
+* Invitations sent to an email address only match once that address is verified.
+*
+* @param user The user.
+*
+* @return *gorm.DB The query.
+ */
+func pendingInvitations(user models.User) *gorm.DB {
+	query := db.DB.Where("accepted_at IS NULL AND declined_at IS NULL AND expires_at > ?", time.Now())
+	if user.EmailConfirm == "true" {
+		return query.Where("invitee_user = ? OR (invitee_user = 0 AND invitee_email = ?)", user.UserUID, user.Email)
+	}
+	return query.Where("invitee_user = ?", user.UserUID)
+}
+
+/*
+* Returns the pending household invitations of the user.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdInvitations(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	var invitations []models.HouseholdInvitation
+	pendingInvitations(user).Preload("HouseholdInfo").Order("created_at").Find(&invitations)
+
+	invitationsDTO := DTO("invitations", invitations)
+	return Success(c, "Invitations returned", invitationsDTO)
+}
+
+/*
+* Accepts a household invitation, making the user a member of the household.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdInvitationAccept(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	var invitation models.HouseholdInvitation
+	result := pendingInvitations(user).Where("invitation_uid = ?", c.Query("invitationUID")).First(&invitation)
+	code, err := RecordExists("Invitation", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&invitation).Update("accepted_at", &now).Error; err != nil {
+			return err
+		}
+
+		var existing models.Membership
+		if tx.Where("household = ? AND member_user = ?", invitation.Household, user.UserUID).First(&existing).Error == nil {
+			return nil
+		}
+		return tx.Create(&models.Membership{
+			Household:  invitation.Household,
+			MemberUser: user.UserUID,
+			MemberRole: invitation.InviteeRole,
+			JoinedAt:   now,
+		}).Error
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error accepting the invitation")
+	}
+	recordAudit(c, invitation.Household, "invitation.accept", "invitation", invitation.InvitationUID, nil, nil)
+
+	householdDTO := DTO("householdUID", invitation.Household)
+	return Success(c, "Invitation was accepted", householdDTO)
+}
+
+/*
+* Declines a household invitation.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdInvitationDecline(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	var invitation models.HouseholdInvitation
+	result := pendingInvitations(user).Where("invitation_uid = ?", c.Query("invitationUID")).First(&invitation)
+	code, err := RecordExists("Invitation", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	db.DB.Model(&invitation).Update("declined_at", time.Now())
+
+	return Success(c, "Invitation was declined")
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/db/dbtest"
+	"WIG-Server/mailer"
+	"WIG-Server/models"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Records the recipients of the emails sent during a test.
+type recordingMailer struct {
+	recipients []string
+}
+
+func (m *recordingMailer) Send(to string, subject string, body string) error {
+	m.recipients = append(m.recipients, to)
+	return nil
+}
+
+func TestDeleteHouseholdDataRemovesNestedLocations(t *testing.T) {
+	dbtest.Open(t)
+
+	owner, household := testUser(t, "owner")
+	guest, _ := testUser(t, "guest")
+
+	// A shed inside a garage, shared with a guest, holding a lent out ownership with history
+	garage := models.Location{LocationName: "Garage", LocationOwner: owner.UserUID, LocationHousehold: household.HouseholdUID}
+	db.DB.Create(&garage)
+	insertLocationClosure(db.DB, garage)
+	shed := models.Location{LocationName: "Shed", LocationOwner: owner.UserUID, LocationHousehold: household.HouseholdUID, Parent: &garage.LocationUID}
+	db.DB.Create(&shed)
+	insertLocationClosure(db.DB, shed)
+	db.DB.Create(&models.LocationGrant{GrantLocation: garage.LocationUID, GrantHousehold: household.HouseholdUID, GrantUser: guest.UserUID, GrantRole: models.HouseholdViewer, GrantedBy: owner.UserUID})
+	borrower := models.Borrower{BorrowerName: "Neighbour", BorrowerOwner: owner.UserUID, BorrowerHousehold: household.HouseholdUID}
+	db.DB.Create(&borrower)
+	ownership := models.Ownership{ItemOwner: owner.UserUID, ItemHousehold: household.HouseholdUID, ItemNumber: 1, CustomItemName: "Drill", ItemLocation: shed.LocationUID, ItemBorrower: borrower.BorrowerUID}
+	db.DB.Create(&ownership)
+	db.DB.Create(&models.OwnershipEvent{EventOwnership: ownership.OwnershipUID, EventHousehold: household.HouseholdUID, EventType: models.OwnershipCreated, Actor: owner.UserUID})
+
+	if err := deleteHouseholdData(db.DB, household.HouseholdUID); err != nil {
+		t.Fatalf("deleteHouseholdData failed: %v", err)
+	}
+
+	counts := []struct {
+		query string
+		model interface{}
+	}{
+		{"location_household = ?", &models.Location{}},
+		{"closure_household = ?", &models.LocationClosure{}},
+		{"grant_household = ?", &models.LocationGrant{}},
+		{"item_household = ?", &models.Ownership{}},
+		{"event_household = ?", &models.OwnershipEvent{}},
+		{"borrower_household = ?", &models.Borrower{}},
+		{"household_uid = ?", &models.Household{}},
+	}
+	for _, c := range counts {
+		var count int64
+		db.DB.Unscoped().Model(c.model).Where(c.query, household.HouseholdUID).Count(&count)
+		if count != 0 {
+			t.Errorf("%d %T records are left", count, c.model)
+		}
+	}
+}
+
+func TestHouseholdInviteHidesInviteeEmail(t *testing.T) {
+	dbtest.Open(t)
+	sent := &recordingMailer{}
+	mailer.Use(sent)
+	t.Cleanup(func() { mailer.Use(mailer.LogMailer{}) })
+
+	owner, household := testUser(t, "owner")
+	friend, _ := testUser(t, "friend")
+	member, _ := testUser(t, "member")
+	db.DB.Create(&models.Membership{Household: household.HouseholdUID, MemberUser: member.UserUID, MemberRole: models.HouseholdEditor, JoinedAt: time.Now()})
+	var membership models.Membership
+	db.DB.Where("household = ? AND member_user = ?", household.HouseholdUID, owner.UserUID).First(&membership)
+	target := fmt.Sprintf("/household/invite?householdUID=%d", household.HouseholdUID)
+
+	// Inviting by username emails the invitee without showing their address to anyone in the household
+	code, response := testRequest(t, HouseholdInvite, owner, membership, "POST", target, `{"username":"friend"}`)
+	if code != 200 {
+		t.Fatalf("Inviting by username returned %d: %v", code, response["message"])
+	}
+	invitation := response["invitation"].(map[string]interface{})
+	if invitation["email"] != "" {
+		t.Errorf("invitation shows the invitees email %v", invitation["email"])
+	}
+	var audit models.AuditLog
+	db.DB.Where("action = ?", "invitation.create").First(&audit)
+	if strings.Contains(string(audit.After), friend.Email) {
+		t.Errorf("audit log shows the invitees email: %s", audit.After)
+	}
+	if len(sent.recipients) != 1 || sent.recipients[0] != friend.Email {
+		t.Errorf("invitation was emailed to %v, want %s", sent.recipients, friend.Email)
+	}
+
+	// Inviting the email of a member looks the same as inviting an address without an account
+	known, knownResponse := testRequest(t, HouseholdInvite, owner, membership, "POST", target, `{"email":"`+member.Email+`"}`)
+	unknown, unknownResponse := testRequest(t, HouseholdInvite, owner, membership, "POST", target, `{"email":"nobody@example.com"}`)
+	if known != unknown || knownResponse["message"] != unknownResponse["message"] {
+		t.Errorf("email invites differ: %d %v and %d %v", known, knownResponse["message"], unknown, unknownResponse["message"])
+	}
+}
+
+func TestHouseholdDeleteKeepsMembersInAHousehold(t *testing.T) {
+	dbtest.Open(t)
+
+	owner, _ := testUser(t, "owner")
+	member, personal := testUser(t, "member")
+	joiner, _ := testUser(t, "joiner")
+	shared, err := createHousehold(db.DB, owner, "Shared")
+	if err != nil {
+		t.Fatalf("Creating the household failed: %v", err)
+	}
+
+	// The member only belongs to the shared household after leaving their own, the joiner still has theirs
+	db.DB.Where("household = ?", personal.HouseholdUID).Delete(&models.Membership{})
+	for _, user := range []models.User{member, joiner} {
+		db.DB.Create(&models.Membership{Household: shared.HouseholdUID, MemberUser: user.UserUID, MemberRole: models.HouseholdEditor, JoinedAt: time.Now()})
+	}
+	var membership models.Membership
+	db.DB.Where("household = ? AND member_user = ?", shared.HouseholdUID, owner.UserUID).First(&membership)
+
+	code, response := testRequest(t, HouseholdDelete, owner, membership, "DELETE", fmt.Sprintf("/household/delete?householdUID=%d", shared.HouseholdUID), "")
+	if code != 200 {
+		t.Fatalf("Deleting the household returned %d: %v", code, response["message"])
+	}
+
+	for _, user := range []models.User{member, joiner} {
+		var count int64
+		db.DB.Model(&models.Membership{}).Where("member_user = ?", user.UserUID).Count(&count)
+		if count != 1 {
+			t.Errorf("%s belongs to %d households, want 1", user.Username, count)
+		}
+	}
+	var created models.Membership
+	db.DB.Where("member_user = ?", member.UserUID).First(&created)
+	if created.MemberRole != models.HouseholdOwner {
+		t.Errorf("member is %s of their new household, want owner", created.MemberRole)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"WIG-Server/db"
 	"WIG-Server/models"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 /*
@@ -17,8 +19,14 @@ import (
 * @return error The error message, if there is any.
  */
 func LocationCreate(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
 	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	locationQR := c.Query("location_qr")
 	locationName := c.Query("location_name")
 	log.Printf("controller#LocationCreate: User %d called LocationCreate", user.UserUID)
@@ -28,16 +36,23 @@ func LocationCreate(c *fiber.Ctx) error {
 		return Error(c, 400, "The locationQR or locationName field is empty")
 	}
 
+	// Enforce the location limit of the household owners tier
+	owner := householdOwner(household)
+	tier := userTier(owner)
+	if !withinQuota(tier.MaxLocations, locationCount(owner), 1) {
+		return quotaExceeded(c, "locations", tier.MaxLocations)
+	}
+
 	// Validate location QR code is not in use
 	var location models.Location
-	result := db.DB.Where("location_qr = ? AND location_owner = ?", locationQR, user.UserUID).First(&location)
+	result := db.DB.Where("location_qr = ? AND location_household = ?", locationQR, household.HouseholdUID).First(&location)
 	code, err := recordNotInUse("Location QR", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
 	// Valide location name is not in use
-	result = db.DB.Where("location_name = ? AND location_owner = ?", locationName, user.UserUID).First(&location)
+	result = db.DB.Where("location_name = ? AND location_household = ?", locationName, household.HouseholdUID).First(&location)
 	code, err = recordNotInUse("Location Name", result)
 	if err != nil {
 		return Error(c, code, err.Error())
@@ -47,10 +62,20 @@ func LocationCreate(c *fiber.Ctx) error {
 	location = models.Location{
 		LocationName:  locationName,
 		LocationOwner: user.UserUID,
+		LocationHousehold: household.HouseholdUID,
 		LocationQR:    locationQR,
 	}
 
-	db.DB.Create(&location)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&location).Error; err != nil {
+			return err
+		}
+		return insertLocationClosure(tx, location)
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error creating the location")
+	}
+	recordAudit(c, household.HouseholdUID, "location.create", "location", location.LocationUID, nil, location)
 	preloadLocation(&location)
 	locationDTO := DTO("location", &location)
 
@@ -65,19 +90,19 @@ func LocationCreate(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
  */
 func LocationSetLocation(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	locationUID := c.Query("location_uid")
 	setLocationUID := c.Query("set_location_uid")
 
-	// Verify locations are not the same
-	if locationUID == setLocationUID {
-		return Error(c, 400, "Cannot set location in itself")
-	}
-
 	// Validate the QR code
 	var location models.Location
-	result := db.DB.Where("location_uid = ? AND location_owner = ?", locationUID, user.UserUID).First(&location)
+	result := db.DB.Where("location_uid = ? AND location_household = ?", locationUID, household.HouseholdUID).First(&location)
 	code, err := RecordExists("Location QR", result)
 	if err != nil {
 		return Error(c, code, err.Error())
@@ -85,15 +110,41 @@ func LocationSetLocation(c *fiber.Ctx) error {
 
 	// Validate the ownership
 	var setLocation models.Location
-	result = db.DB.Where("location_uid = ? AND location_owner = ?", setLocationUID, user.UserUID).First(&setLocation)
+	result = db.DB.Where("location_uid = ? AND location_household = ?", setLocationUID, household.HouseholdUID).First(&setLocation)
 	code, err = RecordExists("Location", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
+	// Verify locations are not the same
+	if location.LocationUID == setLocation.LocationUID {
+		return Error(c, 400, "Cannot set location in itself")
+	}
+
+	// Reject moves into one of the locations own children, or that would nest locations too deep
+	parents := locationParents(household.HouseholdUID)
+	ancestors := locationAncestors(parents, setLocation.LocationUID)
+	if containsLocation(location.LocationUID, ancestors) {
+		return Error(c, 400, "Cannot set location inside of a location it contains", DTO("reason", "location_cycle"))
+	}
+	depth := len(ancestors) + 1 + locationHeight(parents, location.LocationUID)
+	if depth > maxLocationDepth() {
+		return Error(c, 400, "Locations cannot be nested more than "+strconv.Itoa(maxLocationDepth())+" deep", DTO("reason", "location_too_deep"))
+	}
+
 	// Set the location and save
+	before := location
 	location.Parent = &setLocation.LocationUID
-	db.DB.Save(&location)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&location).Error; err != nil {
+			return err
+		}
+		return moveLocationClosure(tx, location, setLocation.LocationUID)
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error setting the location")
+	}
+	recordAudit(c, household.HouseholdUID, "location.set_location", "location", location.LocationUID, before, location)
 
 	// return success
 	return Success(c, location.LocationName+" set in "+setLocation.LocationName)
@@ -107,63 +158,354 @@ func LocationSetLocation(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
  */
 func LocationEdit(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	locationUID := c.Query("locationUID")
 
 	// Validate ownership
 	var location models.Location
-	result := db.DB.Where("location_uid = ? AND location_owner = ?", locationUID, user.UserUID).First(&location)
+	result := db.DB.Where("location_uid = ? AND location_household = ?", locationUID, household.HouseholdUID).First(&location)
 	code, err := RecordExists("Ownership", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
 	// Add new fields
+	before := location
 	location.LocationName = c.Query("location_name")
 	location.LocationDescription = c.Query("location_description")
 	location.LocationTags = c.Query("location_tags")
 
 	db.DB.Save(&location)
+	recordAudit(c, household.HouseholdUID, "location.edit", "location", location.LocationUID, before, location)
 
 	// Ownership successfully updated
 	return Success(c, "Location updated successfully")
 }
 
+// The ways LocationDelete can handle the records inside of a location.
+const (
+	deleteModeRefuse   = "refuse"
+	deleteModeReparent = "reparent"
+	deleteModeDefault  = "default"
+)
+
+/*
+* Moves a location to the trash. The mode query decides what happens to the records inside of it:
+* "refuse" fails unless it is empty, "reparent" moves them to the parent of the location
+* and "default" moves them to the default location.
+* With preview=true nothing is changed and the records that would be affected are returned.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func LocationDelete(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+	locationUID := c.Query("locationUID")
+	mode := c.Query("mode", deleteModeRefuse)
+	preview := c.Query("preview") == "true"
+
+	// Validate location
+	var location models.Location
+	result := db.DB.Where("location_uid = ? AND location_household = ?", locationUID, household.HouseholdUID).First(&location)
+	code, err := RecordExists("Location", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Find the location the contents are moved to
+	var target *models.Location
+	switch mode {
+	case deleteModeRefuse:
+	case deleteModeReparent:
+		target = &models.Location{}
+		if location.Parent != nil && db.DB.Where("location_uid = ?", *location.Parent).First(target).Error == nil {
+			break
+		}
+		if err := db.DB.Where("location_uid = ?", 1).First(target).Error; err != nil {
+			return Error(c, 500, "The default location could not be found")
+		}
+	case deleteModeDefault:
+		target = &models.Location{}
+		if err := db.DB.Where("location_uid = ?", 1).First(target).Error; err != nil {
+			return Error(c, 500, "The default location could not be found")
+		}
+	default:
+		return Error(c, 400, "Mode must be refuse, reparent or default")
+	}
+
+	ownerships, locations := GetAllFromLocation(location, household)
+	affected := models.LocationDeleteDTO{
+		Location:   location,
+		Mode:       mode,
+		Target:     target,
+		Ownerships: ownerships,
+		Locations:  locations,
+	}
+	previewDTO := DTO("preview", affected)
+
+	if preview {
+		return Success(c, "Location delete preview", previewDTO)
+	}
+	if mode == deleteModeRefuse && (len(ownerships) > 0 || len(locations) > 0) {
+		return Error(c, 409, "Location is not empty", DTO("reason", "location_not_empty"), previewDTO)
+	}
+
+	// Move the contents and delete the location together so nothing is left behind on failure
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if target != nil {
+			result := tx.Model(&models.Ownership{}).
+				Where("item_location = ? AND item_household = ?", location.LocationUID, household.HouseholdUID).
+				Update("item_location", target.LocationUID)
+			if result.Error != nil {
+				return result.Error
+			}
+			result = tx.Model(&models.Location{}).
+				Where("location_parent = ? AND location_household = ?", location.LocationUID, household.HouseholdUID).
+				Update("location_parent", target.LocationUID)
+			if result.Error != nil {
+				return result.Error
+			}
+			for _, child := range locations {
+				if err := moveLocationClosure(tx, child, target.LocationUID); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Delete(&location).Error
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error deleting the location")
+	}
+
+	// Record the moves along with the delete
+	recordAudit(c, household.HouseholdUID, "location.delete", "location", location.LocationUID, location, nil)
+	if target != nil {
+		for _, ownership := range ownerships {
+			moved := ownership
+			moved.ItemLocation = target.LocationUID
+			recordAudit(c, household.HouseholdUID, "ownership.set_location", "ownership", ownership.OwnershipUID, ownership, moved)
+			recordOwnershipEvent(c, moved, models.OwnershipMoved, "Moved from "+location.LocationName+" to "+target.LocationName+" when "+location.LocationName+" was deleted", location.LocationName, target.LocationName)
+		}
+		for _, child := range locations {
+			moved := child
+			moved.Parent = &target.LocationUID
+			recordAudit(c, household.HouseholdUID, "location.set_location", "location", child.LocationUID, child, moved)
+		}
+	}
+
+	return Success(c, "Location was moved to the trash", previewDTO)
+}
+
 /*
 * Returns all ownerships and locations stored in a location.
+* With recursive=true the locations inside of it are unpacked as well.
 *
 * @param c The fiber context containing the HTTP request and esponse objects.
 * @return error The error message, if there is any.
 */
 func UnpackLocation( c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionView)
+	if !allowed {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	locationUID := c.Query("locationUID")
 
 	// Validate ownership
 	var location models.Location
-	result := db.DB.Where("location_uid = ? AND location_owner = ?", locationUID, user.UserUID).First(&location)
+	result := db.DB.Where("location_uid = ? AND location_household = ?", locationUID, household.HouseholdUID).First(&location)
 	code, err := RecordExists("Location", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
+	if limited && !containsLocation(location.LocationUID, scope) {
+		return Error(c, 404, "Location was not found in the database")
+	}
+
+	// Everything nested inside of the location is returned with recursive=true
+	if c.Query("recursive") == "true" {
+		return unpackRecursive(c, location, household)
+	}
+
+	ownerships, locations := GetAllFromLocation(location, household)
+
+	preloadOwnerships(ownerships)
+	preloadLocations(locationPointers(locations))
+
+	ownershipDTO := DTO("ownerships", ownerships)
+	locationDTO := DTO("locations", locations)
+
+	return Success(c, "Unpacked", ownershipDTO, locationDTO)
+}
+
+/*
+* Returns every location and ownership nested inside of a location, each with its path from that location,
+* along with totals of everything found.
+*
+* @param c The fiber context containing the HTTP request and esponse objects.
+* @param location The location to unpack.
+* @param household The household the location belongs to.
+*
+* @return error The error message, if there is any.
+ */
+func unpackRecursive(c *fiber.Ctx, location models.Location, household models.Household) error {
+	// Load the hierarchy once and walk down from the location, building the path to each location
+	var all []models.Location
+	db.DB.Preload("User").Where("location_household = ?", household.HouseholdUID).Order("location_name").Find(&all)
+
+	children := map[uint][]models.Location{}
+	for _, child := range all {
+		if child.Parent != nil {
+			children[*child.Parent] = append(children[*child.Parent], child)
+		}
+	}
 
-	ownerships, locations := GetAllFromLocation(location, user)
+	paths := map[uint]string{location.LocationUID: ""}
+	locations := []models.UnpackedLocationDTO{}
+	queue := []uint{location.LocationUID}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range children[parent] {
+			if _, seen := paths[child.LocationUID]; seen {
+				continue
+			}
+			paths[child.LocationUID] = joinPath(paths[parent], child.LocationName)
+			locations = append(locations, models.UnpackedLocationDTO{Location: child, Path: paths[parent]})
+			queue = append(queue, child.LocationUID)
+		}
+	}
 
-	// TODO iterate to preload all ownership and locations
-	for i := range ownerships {
-		preloadOwnership(&ownerships[i])
+	uids := make([]uint, 0, len(paths))
+	for uid := range paths {
+		uids = append(uids, uid)
 	}
 
-	for i := range locations {
-		preloadLocation(&locations[i])
+	var found []models.Ownership
+	db.DB.Preload("User").Preload("Item").Preload("Borrower").Preload("Location").
+		Where("item_household = ? AND item_location IN ?", household.HouseholdUID, uids).
+		Order("custom_item_name").Find(&found)
+
+	containers := make([]*models.Location, 0, len(found))
+	for i := range found {
+		containers = append(containers, &found[i].Location)
+	}
+	preloadLocations(containers)
+
+	totals := models.UnpackTotalsDTO{Locations: len(locations), Ownerships: len(found)}
+	ownerships := make([]models.UnpackedOwnershipDTO, 0, len(found))
+	for _, ownership := range found {
+		totals.Quantity += ownership.ItemQuantity
+		if ownership.ItemBorrower != 1 {
+			totals.CheckedOut++
+		}
+		ownerships = append(ownerships, models.UnpackedOwnershipDTO{Ownership: ownership, Path: paths[ownership.ItemLocation]})
 	}
 
 	ownershipDTO := DTO("ownerships", ownerships)
 	locationDTO := DTO("locations", locations)
+	totalsDTO := DTO("totals", totals)
+	return Success(c, "Unpacked", ownershipDTO, locationDTO, totalsDTO)
+}
 
-	return Success(c, "Unpacked", ownershipDTO, locationDTO)
+/*
+* Adds a location name to the end of a path, e.g. "Garage > Shelf 2".
+*
+* @param path The path, empty for the top.
+* @param name The name to add.
+*
+* @return string The longer path.
+ */
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + " > " + name
+}
+
+/*
+* Returns the location hierarchy of the household as a nested tree, with the number of ownerships in each location.
+* The tree can be rooted at the location given with locationUID, and limited to a number of levels with depth, 0 meaning unlimited.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func LocationTree(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionView)
+	if !allowed {
+		return permissionError(c, permissionView)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+	locationUID := c.Query("locationUID")
+	depth, err := strconv.Atoi(c.Query("depth", "0"))
+	if err != nil || depth < 0 {
+		return Error(c, 400, "Depth must be 0 or a positive number")
+	}
+
+	// Load the whole hierarchy once and build the tree in memory
+	var locations []models.Location
+	db.DB.Where("location_household = ?", household.HouseholdUID).Order("location_name").Find(&locations)
+	counts := ownershipCountsByLocation(household.HouseholdUID)
+
+	byUID := map[uint]models.Location{}
+	for _, location := range locations {
+		if !limited || containsLocation(location.LocationUID, scope) {
+			byUID[location.LocationUID] = location
+		}
+	}
+	children := map[uint][]models.Location{}
+	roots := []models.Location{}
+	for _, location := range locations {
+		if _, ok := byUID[location.LocationUID]; !ok {
+			continue
+		}
+		if location.Parent != nil {
+			if _, ok := byUID[*location.Parent]; ok {
+				children[*location.Parent] = append(children[*location.Parent], location)
+				continue
+			}
+		}
+		roots = append(roots, location)
+	}
+
+	// Start from a single location when one is given
+	if locationUID != "" {
+		uid, err := strconv.ParseUint(locationUID, 10, 64)
+		root, ok := byUID[uint(uid)]
+		if err != nil || !ok {
+			return Error(c, 404, "Location was not found in the database")
+		}
+		roots = []models.Location{root}
+	}
+
+	seen := map[uint]bool{}
+	tree := []models.LocationTreeDTO{}
+	for _, root := range roots {
+		tree = append(tree, buildLocationTree(root, children, counts, depth, seen))
+	}
+
+	treeDTO := DTO("tree", tree)
+	return Success(c, "Location tree returned", treeDTO)
 }
 
 /* 
@@ -174,8 +516,14 @@ func UnpackLocation( c *fiber.Ctx) error {
 * @return error The error message, if there is any.
 */
 func LocationSearch(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionView)
+	if !allowed {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	var data map[string]string
 	err := c.BodyParser(&data)
 	if err != nil {
@@ -187,7 +535,10 @@ func LocationSearch(c *fiber.Ctx) error {
 
 	tagsFormat := strings.Split(strings.TrimSpace(tags), ",")
 
-	query := db.DB.Where("location_owner = ? AND location_name LIKE ?", user.UserUID, "%"+name+"%")
+	query := db.DB.Where("location_household = ? AND location_name LIKE ?", household.HouseholdUID, "%"+name+"%")
+	if limited {
+		query = query.Where("location_uid IN ?", scope)
+	}
 
 	for _, tag := range tagsFormat {
 		query = query.Where("location_tags LIKE ?", "%"+tag+"%")
@@ -197,9 +548,7 @@ func LocationSearch(c *fiber.Ctx) error {
 		return Error(c, 404, "Not found")
 	}
 
-	for i := range locations {
-		preloadLocation(&locations[i])
-	}
+	preloadLocations(locationPointers(locations))
 
 	locationDTO := DTO("locations", locations)
 	return Success(c, "Items found", locationDTO)
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/db/dbtest"
+	"WIG-Server/models"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLocationDeleteWithoutDefaultLocation(t *testing.T) {
+	dbtest.Open(t)
+
+	owner, household := testUser(t, "owner")
+	garage := models.Location{LocationName: "Garage", LocationOwner: owner.UserUID, LocationHousehold: household.HouseholdUID}
+	db.DB.Create(&garage)
+	insertLocationClosure(db.DB, garage)
+	db.DB.Create(&models.Ownership{ItemOwner: owner.UserUID, ItemHousehold: household.HouseholdUID, ItemNumber: 1, CustomItemName: "Drill", ItemLocation: garage.LocationUID})
+	db.DB.Model(&garage).Update("location_parent", nil)
+	if err := db.DB.Unscoped().Where("location_uid = ?", 1).Delete(&models.Location{}).Error; err != nil {
+		t.Fatalf("Deleting the default location failed: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", owner)
+		c.Locals("household", household)
+		c.Locals("membership", models.Membership{Household: household.HouseholdUID, MemberUser: owner.UserUID, MemberRole: models.HouseholdOwner})
+		return c.Next()
+	})
+	app.Delete("/location/delete", LocationDelete)
+
+	for _, query := range []string{"&mode=reparent", "&mode=default", "&mode=reparent&preview=true", "&mode=default&preview=true"} {
+		response, err := app.Test(httptest.NewRequest("DELETE", "/location/delete?locationUID="+strconv.Itoa(int(garage.LocationUID))+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if response.StatusCode != 500 {
+			t.Errorf("%s returned %d, want 500", query, response.StatusCode)
+		}
+	}
+
+	// Nothing was moved or deleted
+	var ownership models.Ownership
+	db.DB.Where("item_household = ?", household.HouseholdUID).First(&ownership)
+	if ownership.ItemLocation != garage.LocationUID {
+		t.Errorf("ownership was moved to %d", ownership.ItemLocation)
+	}
+	if err := db.DB.First(&models.Location{}, garage.LocationUID).Error; err != nil {
+		t.Errorf("location was deleted: %v", err)
+	}
+}
+
+func TestLocationSetLocationRejectsItself(t *testing.T) {
+	dbtest.Open(t)
+
+	owner, household := testUser(t, "owner")
+	garage := models.Location{LocationName: "Garage", LocationOwner: owner.UserUID, LocationHousehold: household.HouseholdUID}
+	db.DB.Create(&garage)
+	insertLocationClosure(db.DB, garage)
+	var membership models.Membership
+	db.DB.Where("household = ? AND member_user = ?", household.HouseholdUID, owner.UserUID).First(&membership)
+
+	// The same UID written differently still names the same location
+	uid := strconv.Itoa(int(garage.LocationUID))
+	code, response := testRequest(t, LocationSetLocation, owner, membership, "PUT", "/location/set-location?location_uid="+uid+"&set_location_uid=0"+uid, "")
+	if code != 400 {
+		t.Errorf("Setting a location in itself returned %d: %v", code, response["message"])
+	}
+	db.DB.First(&garage, garage.LocationUID)
+	if garage.Parent != nil && *garage.Parent == garage.LocationUID {
+		t.Errorf("location was set in itself")
+	}
+}
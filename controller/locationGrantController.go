@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+/*
+* Returns the given locations along with every location below them in the tree.
+*
+* @param householdUID The UID of the household the locations belong to.
+* @param roots The UIDs of the locations to start from.
+*
+* @return []uint The UIDs of the roots and their descendants.
+ */
+func locationSubtree(householdUID uint, roots []uint) []uint {
+	var locations []models.Location
+	db.DB.Select("location_uid", "location_parent").Where("location_household = ?", householdUID).Find(&locations)
+
+	children := map[uint][]uint{}
+	for _, location := range locations {
+		if location.Parent != nil {
+			children[*location.Parent] = append(children[*location.Parent], location.LocationUID)
+		}
+	}
+
+	seen := map[uint]bool{}
+	subtree := []uint{}
+	queue := append([]uint{}, roots...)
+	for len(queue) > 0 {
+		uid := queue[0]
+		queue = queue[1:]
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		subtree = append(subtree, uid)
+		queue = append(queue, children[uid]...)
+	}
+	return subtree
+}
+
+/*
+* Works out which locations a request may use for a permission.
+* Members are limited by their role only, users with location grants are limited to the granted subtrees.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param permission The permission, e.g. "view".
+*
+* @return []uint The UIDs of the accessible locations, only set when the request is limited.
+* @return bool Whether the request is limited to those locations.
+* @return bool Whether the permission is granted at all.
+ */
+func accessScope(c *fiber.Ctx, permission string) ([]uint, bool, bool) {
+	if _, ok := c.Locals("membership").(models.Membership); ok {
+		return nil, false, hasPermission(c, permission)
+	}
+
+	grants, _ := c.Locals("grants").([]models.LocationGrant)
+	household := c.Locals("household").(models.Household)
+
+	roots := []uint{}
+	for _, grant := range grants {
+		if rolePermits(grant.GrantRole, permission) {
+			roots = append(roots, grant.GrantLocation)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, true, false
+	}
+	return locationSubtree(household.HouseholdUID, roots), true, true
+}
+
+/*
+* Checks whether a location UID is in a list of location UIDs.
+*
+* @param locationUID The location UID.
+* @param locations The list of location UIDs.
+*
+* @return bool Whether the location is in the list.
+ */
+func containsLocation(locationUID uint, locations []uint) bool {
+	for _, uid := range locations {
+		if uid == locationUID {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* Returns the grants of the household, optionally only those on a single location.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func LocationGrants(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+	locationUID := c.Query("locationUID")
+
+	query := db.DB.Preload("User").Preload("Location").Where("grant_household = ?", household.HouseholdUID)
+	if locationUID != "" {
+		query = query.Where("grant_location = ?", locationUID)
+	}
+
+	var grants []models.LocationGrant
+	query.Order("grant_uid").Find(&grants)
+
+	grantsDTO := DTO("grants", grants)
+	return Success(c, "Grants returned", grantsDTO)
+}
+
+/*
+* Grants a user outside the household access to a location and everything inside it.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func LocationGrantCreate(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["username"] == "" {
+		return Error(c, 400, "Username is empty and required")
+	}
+	role := data["role"]
+	if role == "" {
+		role = models.HouseholdViewer
+	}
+	if role != models.HouseholdViewer && role != models.HouseholdBorrowOnly {
+		return Error(c, 400, "Role must be viewer or borrow-only")
+	}
+
+	// Validate location
+	var location models.Location
+	result := db.DB.Where("location_uid = ? AND location_household = ?", c.Query("locationUID"), household.HouseholdUID).First(&location)
+	code, err := RecordExists("Location", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Validate grantee
+	var grantee models.User
+	result = db.DB.Where("username = ?", data["username"]).First(&grantee)
+	code, err = RecordExists("Username", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	var membership models.Membership
+	result = db.DB.Where("household = ? AND member_user = ?", household.HouseholdUID, grantee.UserUID).First(&membership)
+	if result.Error == nil {
+		return Error(c, 400, "User is already a member of the household")
+	}
+
+	// Replace an existing grant on the same location
+	grant := models.LocationGrant{
+		GrantLocation:  location.LocationUID,
+		GrantHousehold: household.HouseholdUID,
+		GrantUser:      grantee.UserUID,
+		GrantRole:      role,
+		GrantedBy:      user.UserUID,
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("grant_location = ? AND grant_user = ?", location.LocationUID, grantee.UserUID).Delete(&models.LocationGrant{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&grant).Error
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error sharing the location")
+	}
+	recordAudit(c, household.HouseholdUID, "grant.create", "grant", grant.GrantUID, nil, grant)
+
+	grantDTO := DTO("grant", grant)
+	return Success(c, location.LocationName+" was shared with "+grantee.Username, grantDTO)
+}
+
+/*
+* Revokes a location grant.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func LocationGrantRevoke(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+
+	var grant models.LocationGrant
+	result := db.DB.Where("grant_uid = ? AND grant_household = ?", c.Query("grantUID"), household.HouseholdUID).First(&grant)
+	code, err := RecordExists("Grant", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	db.DB.Delete(&grant)
+	recordAudit(c, household.HouseholdUID, "grant.revoke", "grant", grant.GrantUID, grant, nil)
+
+	return Success(c, "Grant was successfully revoked")
+}
+
+/*
+* Returns the locations other households have shared with the user.
+* The householdUID of a grant is sent in the Household header to use it.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func HouseholdShared(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	var grants []models.LocationGrant
+	db.DB.Preload("Location").Where("grant_user = ?", user.UserUID).Order("grant_uid").Find(&grants)
+
+	grantsDTO := DTO("grants", grants)
+	return Success(c, "Shared locations returned", grantsDTO)
+}
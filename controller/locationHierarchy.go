@@ -0,0 +1,514 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// How deep locations can be nested when MAX_LOCATION_DEPTH is not set.
+const defaultMaxLocationDepth = 16
+
+/*
+* Returns how deep locations can be nested, a location in the default location has a depth of 1.
+*
+* @return int The maximum depth.
+ */
+func maxLocationDepth() int {
+	return envInt("MAX_LOCATION_DEPTH", defaultMaxLocationDepth)
+}
+
+/*
+* Loads the parent of every location in a household with a single query.
+*
+* @param householdUID The UID of the household the locations belong to.
+*
+* @return map[uint]uint The parent UID of each location UID.
+ */
+func locationParents(householdUID uint) map[uint]uint {
+	var locations []models.Location
+	db.DB.Select("location_uid", "location_parent").Where("location_household = ?", householdUID).Find(&locations)
+
+	// Locations without a parent are kept with a parent of 0, so every location of the household is known
+	parents := map[uint]uint{}
+	for _, location := range locations {
+		parents[location.LocationUID] = 0
+		if location.Parent != nil {
+			parents[location.LocationUID] = *location.Parent
+		}
+	}
+	return parents
+}
+
+/*
+* Returns the chain of parents above a location, nearest first, ending before the default location.
+* The walk stops if the chain loops back on itself.
+*
+* @param parents The parent of each location, see locationParents.
+* @param locationUID The UID of the location to start from.
+*
+* @return []uint The UIDs of the ancestors.
+ */
+func locationAncestors(parents map[uint]uint, locationUID uint) []uint {
+	ancestors := []uint{}
+	seen := map[uint]bool{locationUID: true}
+
+	parent, ok := parents[locationUID]
+	for ok && !seen[parent] {
+		if _, known := parents[parent]; !known {
+			break
+		}
+		seen[parent] = true
+		ancestors = append(ancestors, parent)
+		parent, ok = parents[parent]
+	}
+	return ancestors
+}
+
+/*
+* Returns how many levels of locations a location holds, counting itself.
+*
+* @param parents The parent of each location, see locationParents.
+* @param locationUID The UID of the location.
+*
+* @return int The height of the location, 1 when it holds no other locations.
+ */
+func locationHeight(parents map[uint]uint, locationUID uint) int {
+	children := map[uint][]uint{}
+	for child, parent := range parents {
+		children[parent] = append(children[parent], child)
+	}
+
+	seen := map[uint]bool{locationUID: true}
+	level := []uint{locationUID}
+	height := 0
+	for len(level) > 0 {
+		height++
+		next := []uint{}
+		for _, uid := range level {
+			for _, child := range children[uid] {
+				if !seen[child] {
+					seen[child] = true
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+	return height
+}
+
+/*
+* Checks whether a location can be placed inside of a parent in its household
+* without forming a loop or nesting locations more than MAX_LOCATION_DEPTH deep.
+*
+* @param householdUID The UID of the household the locations belong to.
+* @param locationUID The UID of the location.
+* @param parentUID The UID of the parent.
+*
+* @return bool Whether the location fits inside of the parent, false when the parent is not in the household.
+ */
+func locationFits(householdUID uint, locationUID uint, parentUID uint) bool {
+	parents := locationParents(householdUID)
+	if _, ok := parents[parentUID]; !ok || parentUID == locationUID {
+		return false
+	}
+
+	// The location may be in the trash, so it is added with its new parent
+	parents[locationUID] = parentUID
+	ancestors := locationAncestors(parents, parentUID)
+	if containsLocation(locationUID, ancestors) {
+		return false
+	}
+	return len(ancestors)+1+locationHeight(parents, locationUID) <= maxLocationDepth()
+}
+
+/*
+* Finds locations whose chain of parents loops back on itself and moves one location of each loop
+* into the default location, which breaks the loop.
+* Called periodically by the tasks package and from the command line.
+*
+* @return int The number of loops that were repaired.
+ */
+func RepairLocationCycles() int {
+	var locations []models.Location
+	db.DB.Where("location_uid <> 1").Find(&locations)
+
+	byUID := map[uint]models.Location{}
+	parents := map[uint]uint{}
+	for _, location := range locations {
+		byUID[location.LocationUID] = location
+		if location.Parent != nil {
+			parents[location.LocationUID] = *location.Parent
+		}
+	}
+
+	// Walk up from every location, a location met twice on the same walk is part of a loop
+	const (
+		unvisited = iota
+		walking
+		done
+	)
+	state := map[uint]int{}
+	repaired := 0
+	for _, start := range locations {
+		path := []uint{}
+		uid := start.LocationUID
+		for {
+			if _, ok := byUID[uid]; !ok || state[uid] == done {
+				break
+			}
+			if state[uid] == walking {
+				if repairLocationCycle(byUID, path, uid) {
+					repaired++
+				}
+				break
+			}
+			state[uid] = walking
+			path = append(path, uid)
+
+			parent, ok := parents[uid]
+			if !ok {
+				break
+			}
+			uid = parent
+		}
+		for _, visited := range path {
+			state[visited] = done
+		}
+	}
+
+	// The closure table was built from the loops, so it is built again once they are gone
+	if repaired > 0 {
+		if err := db.RebuildLocationClosures(db.DB); err != nil {
+			log.Printf("controller#RepairLocationCycles: Error rebuilding the location closure table: %v", err)
+		}
+	}
+	return repaired
+}
+
+/*
+* Breaks a loop of locations by moving the location with the lowest UID into the default location.
+*
+* @param byUID Every location by its UID.
+* @param path The locations walked before the loop was found.
+* @param loopStart The UID of the first location of the loop.
+*
+* @return bool Whether the loop was repaired.
+ */
+func repairLocationCycle(byUID map[uint]models.Location, path []uint, loopStart uint) bool {
+	loop := []uint{}
+	for i, uid := range path {
+		if uid == loopStart {
+			loop = path[i:]
+			break
+		}
+	}
+	if len(loop) == 0 {
+		return false
+	}
+
+	lowest := loop[0]
+	for _, uid := range loop {
+		if uid < lowest {
+			lowest = uid
+		}
+	}
+
+	before := byUID[lowest]
+	after := before
+	parent := uint(1)
+	after.Parent = &parent
+	if err := db.DB.Model(&models.Location{}).Where("location_uid = ?", lowest).Update("location_parent", parent).Error; err != nil {
+		log.Printf("controller#repairLocationCycle: Error repairing location %d: %v", lowest, err)
+		return false
+	}
+
+	appendAudit(before.LocationHousehold, 0, "location.repair_cycle", "location", lowest, before, after)
+	log.Printf("controller#repairLocationCycle: Moved location %d into the default location to break a loop of %d locations", lowest, len(loop))
+	return true
+}
+
+/*
+* Counts the ownerships directly inside of each location of a household with a single query.
+*
+* @param householdUID The UID of the household the ownerships belong to.
+*
+* @return map[uint]int64 The number of ownerships by location UID.
+ */
+func ownershipCountsByLocation(householdUID uint) map[uint]int64 {
+	var rows []struct {
+		ItemLocation uint
+		Count        int64
+	}
+	db.DB.Model(&models.Ownership{}).Select("item_location, COUNT(*) AS count").
+		Where("item_household = ?", householdUID).Group("item_location").Scan(&rows)
+
+	counts := map[uint]int64{}
+	for _, row := range rows {
+		counts[row.ItemLocation] = row.Count
+	}
+	return counts
+}
+
+/*
+* Builds the nested tree below a location from locations that were already loaded.
+*
+* @param location The location at the top of the tree.
+* @param children The locations inside of each location UID.
+* @param counts The number of ownerships directly inside of each location UID.
+* @param depth How many levels to include, counting the location itself, 0 for every level.
+* @param seen The locations already in the tree, which guards against loops.
+*
+* @return models.LocationTreeDTO The tree.
+ */
+func buildLocationTree(location models.Location, children map[uint][]models.Location, counts map[uint]int64, depth int, seen map[uint]bool) models.LocationTreeDTO {
+	seen[location.LocationUID] = true
+	node := models.LocationTreeDTO{
+		LocationUID:     location.LocationUID,
+		LocationName:    location.LocationName,
+		LocationQR:      location.LocationQR,
+		Ownerships:      counts[location.LocationUID],
+		TotalOwnerships: counts[location.LocationUID],
+		Children:        []models.LocationTreeDTO{},
+	}
+
+	for _, child := range children[location.LocationUID] {
+		if seen[child.LocationUID] {
+			continue
+		}
+		// Below the depth limit the children are only counted
+		if depth == 1 {
+			node.TotalOwnerships += buildLocationTree(child, children, counts, 0, seen).TotalOwnerships
+			continue
+		}
+		childDepth := 0
+		if depth > 1 {
+			childDepth = depth - 1
+		}
+		childNode := buildLocationTree(child, children, counts, childDepth, seen)
+		node.TotalOwnerships += childNode.TotalOwnerships
+		node.Children = append(node.Children, childNode)
+	}
+	return node
+}
+
+/*
+* Adds a new location to the closure table, below the chain of its parent.
+*
+* @param tx The transaction to make the changes in.
+* @param location The location that was created.
+*
+* @return error The error message, if there is one.
+ */
+func insertLocationClosure(tx *gorm.DB, location models.Location) error {
+	self := models.LocationClosure{
+		Ancestor:         location.LocationUID,
+		Descendant:       location.LocationUID,
+		ClosureHousehold: location.LocationHousehold,
+	}
+	if err := tx.Create(&self).Error; err != nil {
+		return err
+	}
+	if location.Parent == nil {
+		return nil
+	}
+	return tx.Exec("INSERT INTO location_closures (ancestor, descendant, depth, closure_household) "+
+		"SELECT ancestor, ?, depth + 1, ? FROM location_closures WHERE descendant = ?",
+		location.LocationUID, location.LocationHousehold, *location.Parent).Error
+}
+
+/*
+* Moves a location and everything inside of it below a new parent in the closure table.
+*
+* @param tx The transaction to make the changes in.
+* @param location The location being moved.
+* @param parentUID The UID of the new parent, 1 for the default location.
+*
+* @return error The error message, if there is one.
+ */
+func moveLocationClosure(tx *gorm.DB, location models.Location, parentUID uint) error {
+	var subtree []models.LocationClosure
+	if err := tx.Where("ancestor = ?", location.LocationUID).Find(&subtree).Error; err != nil {
+		return err
+	}
+
+	// A location missing from the table is added on its own
+	if len(subtree) == 0 {
+		self := models.LocationClosure{
+			Ancestor:         location.LocationUID,
+			Descendant:       location.LocationUID,
+			ClosureHousehold: location.LocationHousehold,
+		}
+		if err := tx.Create(&self).Error; err != nil {
+			return err
+		}
+		subtree = append(subtree, self)
+	}
+
+	descendants := make([]uint, 0, len(subtree))
+	for _, closure := range subtree {
+		descendants = append(descendants, closure.Descendant)
+	}
+
+	// Detach the subtree from its old ancestors, then attach it below the ancestors of the new parent
+	err := tx.Where("descendant IN ? AND ancestor NOT IN ?", descendants, descendants).Delete(&models.LocationClosure{}).Error
+	if err != nil {
+		return err
+	}
+
+	var above []models.LocationClosure
+	if err := tx.Where("descendant = ?", parentUID).Find(&above).Error; err != nil {
+		return err
+	}
+
+	closures := []models.LocationClosure{}
+	for _, ancestor := range above {
+		for _, descendant := range subtree {
+			closures = append(closures, models.LocationClosure{
+				Ancestor:         ancestor.Ancestor,
+				Descendant:       descendant.Descendant,
+				Depth:            ancestor.Depth + descendant.Depth + 1,
+				ClosureHousehold: location.LocationHousehold,
+			})
+		}
+	}
+	if len(closures) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(closures, 500).Error
+}
+
+/*
+* Removes a location from the closure table.
+*
+* @param tx The transaction to make the changes in.
+* @param locationUID The UID of the location being removed.
+*
+* @return error The error message, if there is one.
+ */
+func removeLocationClosure(tx *gorm.DB, locationUID uint) error {
+	return tx.Where("ancestor = ? OR descendant = ?", locationUID, locationUID).Delete(&models.LocationClosure{}).Error
+}
+
+/*
+* Loads the chain of locations above each of the given locations using the closure table.
+*
+* @param locationUIDs The UIDs of the locations.
+*
+* @return map[uint][]models.Location The chain of each location UID, from the top down to the location itself.
+ */
+func locationChains(locationUIDs []uint) map[uint][]models.Location {
+	chains := map[uint][]models.Location{}
+	if len(locationUIDs) == 0 {
+		return chains
+	}
+
+	var closures []models.LocationClosure
+	db.DB.Where("descendant IN ?", locationUIDs).Order("descendant, depth DESC").Find(&closures)
+
+	ancestorUIDs := make([]uint, 0, len(closures))
+	for _, closure := range closures {
+		ancestorUIDs = append(ancestorUIDs, closure.Ancestor)
+	}
+	var ancestors []models.Location
+	db.DB.Preload("User").Where("location_uid IN ?", ancestorUIDs).Find(&ancestors)
+
+	byUID := map[uint]models.Location{}
+	for _, ancestor := range ancestors {
+		byUID[ancestor.LocationUID] = ancestor
+	}
+	for _, closure := range closures {
+		if ancestor, ok := byUID[closure.Ancestor]; ok {
+			chains[closure.Descendant] = append(chains[closure.Descendant], ancestor)
+		}
+	}
+	return chains
+}
+
+/*
+* Preloads the owner, the parents and the breadcrumb of each location, using the same few queries for all of them.
+*
+* @param locations The locations to preload.
+ */
+func preloadLocations(locations []*models.Location) {
+	uids := make([]uint, 0, len(locations))
+	for _, location := range locations {
+		uids = append(uids, location.LocationUID)
+	}
+	chains := locationChains(uids)
+
+	for _, location := range locations {
+		chain := chains[location.LocationUID]
+		if len(chain) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(chain))
+		for _, ancestor := range chain {
+			names = append(names, ancestor.LocationName)
+		}
+		location.Breadcrumb = strings.Join(names, " > ")
+		location.User = chain[len(chain)-1].User
+
+		// Link the parents from the bottom up, the top location keeps no parent
+		current := location
+		for i := len(chain) - 2; i >= 0; i-- {
+			parent := chain[i]
+			current.Location = &parent
+			current = &parent
+		}
+		current.Location = nil
+	}
+}
+
+/*
+* Preloads the foreignkey structs of each ownership, using the same few queries for all of them.
+*
+* @param ownerships The ownerships to preload.
+ */
+func preloadOwnerships(ownerships []models.Ownership) {
+	if len(ownerships) == 0 {
+		return
+	}
+
+	uids := make([]uint, 0, len(ownerships))
+	for _, ownership := range ownerships {
+		uids = append(uids, ownership.OwnershipUID)
+	}
+	var loaded []models.Ownership
+	db.DB.Unscoped().Preload("User").Preload("Item").Preload("Borrower").Preload("Location").
+		Where("ownership_uid IN ?", uids).Find(&loaded)
+
+	byUID := map[uint]models.Ownership{}
+	for _, ownership := range loaded {
+		byUID[ownership.OwnershipUID] = ownership
+	}
+
+	locations := make([]*models.Location, 0, len(ownerships))
+	for i := range ownerships {
+		if ownership, ok := byUID[ownerships[i].OwnershipUID]; ok {
+			ownerships[i] = ownership
+		}
+		locations = append(locations, &ownerships[i].Location)
+	}
+	preloadLocations(locations)
+}
+
+/*
+* Returns a pointer to each location in a slice, for preloading them in place.
+*
+* @param locations The locations.
+*
+* @return []*models.Location The pointers to the locations.
+ */
+func locationPointers(locations []models.Location) []*models.Location {
+	pointers := make([]*models.Location, 0, len(locations))
+	for i := range locations {
+		pointers = append(pointers, &locations[i])
+	}
+	return pointers
+}
@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/mailer"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/joho/godotenv"
+)
+
+// The purpose of an action token that lifts a login lockout.
+const purposeUnlockAccount = "unlock_account"
+
+// The default number of failed logins for a username before it is locked.
+const defaultMaxUserAttempts = 5
+
+// The default number of failed logins from an IP address before it is locked.
+const defaultMaxIPAttempts = 20
+
+// A password hash with the current parameters, checked against when a username does not exist.
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+/*
+* Returns the throttle key of a username.
+*
+* @param username The username.
+*
+* @return string The throttle key.
+ */
+func userThrottleKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+/*
+* Returns the throttle key of the IP address making the request.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return string The throttle key.
+ */
+func ipThrottleKey(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+/*
+* Returns how long the longest active lockout of the given keys lasts.
+*
+* @param keys The throttle keys to check.
+*
+* @return time.Duration The remaining lockout, 0 if none of the keys are locked.
+ */
+func lockoutRemaining(keys ...string) time.Duration {
+	var throttles []models.LoginThrottle
+	db.DB.Where("throttle_key IN ? AND locked_until > ?", keys, time.Now()).Find(&throttles)
+
+	var remaining time.Duration
+	for _, throttle := range throttles {
+		if until := time.Until(*throttle.LockedUntil); until > remaining {
+			remaining = until
+		}
+	}
+	return remaining
+}
+
+/*
+* Returns a 429 response for a locked username or IP address.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param remaining How long the lockout lasts.
+*
+* @return error The c.Status being returned via fiber.
+ */
+func lockoutError(c *fiber.Ctx, remaining time.Duration) error {
+	retryAfter := int(math.Ceil(remaining.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return Error(c, 429, "Too many failed login attempts, try again later", DTO("reason", "login_locked"), DTO("retryAfter", retryAfter))
+}
+
+/*
+* Records a failed login for a key and locks it once the maximum number of attempts is reached.
+* Every failure after that doubles the lockout, up to LOGIN_LOCKOUT_MAX.
+* Failures older than LOGIN_ATTEMPT_WINDOW are forgotten.
+*
+* @param key The throttle key.
+* @param maxAttempts The number of failures allowed before locking.
+*
+* @return bool Whether this failure locked the key.
+ */
+func recordThrottleFailure(key string, maxAttempts int) bool {
+	now := time.Now()
+	window := utils.EnvDuration("LOGIN_ATTEMPT_WINDOW", time.Hour)
+	base := utils.EnvDuration("LOGIN_LOCKOUT_BASE", time.Minute)
+	maximum := utils.EnvDuration("LOGIN_LOCKOUT_MAX", time.Hour)
+
+	var throttle models.LoginThrottle
+	result := db.DB.Where("throttle_key = ?", key).First(&throttle)
+	if result.Error != nil || now.Sub(throttle.LastFailure) > window {
+		throttle = models.LoginThrottle{ThrottleKey: key}
+	}
+
+	throttle.Failures++
+	throttle.LastFailure = now
+
+	locked := false
+	if throttle.Failures >= maxAttempts {
+		lockout := base << uint(min(throttle.Failures-maxAttempts, 30))
+		if lockout <= 0 || lockout > maximum {
+			lockout = maximum
+		}
+		until := now.Add(lockout)
+		throttle.LockedUntil = &until
+		locked = true
+	}
+
+	db.DB.Save(&throttle)
+	return locked
+}
+
+/*
+* Records a failed login for the username and IP address of the request.
+* When the username becomes locked and belongs to an account, an unlock email is sent.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param username The username the login was attempted for.
+ */
+func recordLoginFailure(c *fiber.Ctx, username string) {
+	recordThrottleFailure(ipThrottleKey(c), envInt("LOGIN_MAX_IP_ATTEMPTS", defaultMaxIPAttempts))
+	if !recordThrottleFailure(userThrottleKey(username), envInt("LOGIN_MAX_ATTEMPTS", defaultMaxUserAttempts)) {
+		return
+	}
+
+	var user models.User
+	if db.DB.Where("username = ?", username).First(&user).Error != nil {
+		return
+	}
+	log.Printf("controller#recordLoginFailure: User %d was locked after repeated failed logins", user.UserUID)
+	if err := sendUnlockEmail(user); err != nil {
+		log.Printf("controller#recordLoginFailure: Error sending unlock email: %v", err)
+	}
+}
+
+/*
+* Clears the failed logins of a username.
+*
+* @param username The username.
+ */
+func resetLoginThrottle(username string) {
+	db.DB.Where("throttle_key = ?", userThrottleKey(username)).Delete(&models.LoginThrottle{})
+}
+
+/*
+* Reads a positive integer from the .env file.
+*
+* @param key The name of the environment variable.
+* @param fallback The value used when the variable is missing or invalid.
+*
+* @return int The configured value.
+ */
+func envInt(key string, fallback int) int {
+	godotenv.Load()
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+/*
+* Generates a salt for a username that does not exist, so UserSalt cannot be used to discover accounts.
+* The salt is derived from the username, so repeated requests return the same value,
+* and it takes the length and alphabet of a real salt.
+*
+* @param username The username that was requested.
+*
+* @return string The fake salt.
+ */
+func fakeSalt(username string) string {
+	var sample models.User
+	db.DB.Where("salt <> ''").Order("user_uid DESC").First(&sample)
+
+	length := len(sample.Salt)
+	alphabet := "0123456789abcdef"
+	if length == 0 {
+		length = 32
+	}
+	for _, char := range sample.Salt {
+		if !strings.ContainsRune(alphabet, char) {
+			alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+			break
+		}
+	}
+
+	godotenv.Load()
+	mac := hmac.New(sha256.New, []byte(os.Getenv("TOKEN_SECRET")))
+	salt := make([]byte, 0, length)
+	for counter := uint64(0); len(salt) < length; counter++ {
+		mac.Reset()
+		mac.Write([]byte("salt:" + strings.ToLower(username)))
+		binary.Write(mac, binary.BigEndian, counter)
+		for _, b := range mac.Sum(nil) {
+			if len(salt) == length {
+				break
+			}
+			salt = append(salt, alphabet[int(b)%len(alphabet)])
+		}
+	}
+	return string(salt)
+}
+
+/*
+* Checks a credential against a hash that matches nothing, so a login for a username that does not exist
+* takes as long as one for a username that does.
+*
+* @param credential The credential sent with the login.
+ */
+func verifyDummyPassword(credential string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = utils.HashPassword("WIG-Server dummy password")
+	})
+	utils.VerifyPassword(credential, dummyHash)
+}
+
+/*
+* Sends the user an email containing a link that lifts their login lockout.
+*
+* @param user The user to send the email to.
+*
+* @return error The error message, if there is one.
+ */
+func sendUnlockEmail(user models.User) error {
+	token, err := issueActionToken(user, purposeUnlockAccount, utils.EnvDuration("ACCOUNT_UNLOCK_LIFETIME", 24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	body := "Hi " + user.Username + ",\n\n" +
+		"Your WIG account was temporarily locked after several failed login attempts. " +
+		"If this was you, open the link below to unlock it now:\n\n" +
+		appLink("unlock", token) + "\n\n" +
+		"If this was not you, consider resetting your password."
+
+	return mailer.Send(user.Email, "Your WIG account was locked", body)
+}
+
+/*
+* Lifts the login lockout of a user with the token sent in the unlock email.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserUnlock(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["token"] == "" {
+		return Error(c, 400, "Token is empty and required")
+	}
+
+	user, err := consumeActionToken(data["token"], purposeUnlockAccount)
+	if err != nil {
+		return actionTokenError(c, err)
+	}
+
+	resetLoginThrottle(user.Username)
+
+	return Success(c, "Account was successfully unlocked")
+}
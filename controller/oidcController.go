@@ -0,0 +1,381 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"WIG-Server/oidc"
+	"WIG-Server/utils"
+	"errors"
+	"log"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Returned by consumeOIDCState when the state is unknown, expired or for another flow.
+var errOIDCState = errors.New("state is invalid or has expired")
+
+// Returned when every username tried for a new identity provider account is taken.
+var errOIDCUsername = errors.New("no unused username was found")
+
+// Matches the characters that are not allowed in usernames.
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+/*
+* Starts an authorization request with a provider and returns the URL to send the user to.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param provider The identity provider.
+* @param linkUser The UID of the user linking an identity, or 0 for a login.
+*
+* @return error The error message, if there is any.
+ */
+func startOIDC(c *fiber.Ctx, provider oidc.Provider, linkUser uint) error {
+	state, errState := utils.GenerateRandomToken(32)
+	nonce, errNonce := utils.GenerateRandomToken(32)
+	verifier, errVerifier := utils.GenerateRandomToken(48)
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		return Error(c, 500, "There was an error starting the login")
+	}
+
+	authURL, err := provider.AuthURL(state, nonce, verifier)
+	if err != nil {
+		log.Printf("controller#startOIDC: %v", err)
+		return Error(c, 502, "The identity provider could not be reached")
+	}
+
+	oidcState := models.OIDCState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUser:     linkUser,
+		ExpiresAt:    time.Now().Add(utils.EnvDuration("OIDC_STATE_LIFETIME", 10*time.Minute)),
+	}
+	if err := db.DB.Create(&oidcState).Error; err != nil {
+		return Error(c, 500, "There was an error starting the login")
+	}
+
+	authURLDTO := DTO("authUrl", authURL)
+	stateDTO := DTO("state", state)
+	return Success(c, "Authorization started", authURLDTO, stateDTO)
+}
+
+/*
+* Looks up and deletes a pending authorization request, so each state can only be used once.
+*
+* @param provider The identity provider the callback is for.
+* @param state The state returned by the provider.
+* @param linkUser The UID of the user linking an identity, or 0 for a login.
+*
+* @return models.OIDCState The pending authorization request.
+* @return error errOIDCState, if the state cannot be used.
+ */
+func consumeOIDCState(provider oidc.Provider, state string, linkUser uint) (models.OIDCState, error) {
+	var oidcState models.OIDCState
+	result := db.DB.Where("state_hash = ? AND provider = ? AND link_user = ?", utils.HashToken(state), provider.Name, linkUser).First(&oidcState)
+	if result.Error != nil {
+		return oidcState, errOIDCState
+	}
+
+	result = db.DB.Delete(&oidcState)
+	if result.Error != nil || result.RowsAffected == 0 || time.Now().After(oidcState.ExpiresAt) {
+		return oidcState, errOIDCState
+	}
+	return oidcState, nil
+}
+
+/*
+* Completes an authorization request by validating the state and exchanging the code.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param data The request body containing code and state.
+* @param linkUser The UID of the user linking an identity, or 0 for a login.
+*
+* @return oidc.Provider The identity provider.
+* @return oidc.Identity The verified identity.
+* @return int The HTTP error code to return
+* @return error The error message, if there is one.
+ */
+func finishOIDC(c *fiber.Ctx, data map[string]string, linkUser uint) (oidc.Provider, oidc.Identity, int, error) {
+	if data["code"] == "" || data["state"] == "" {
+		return oidc.Provider{}, oidc.Identity{}, 400, errors.New("Code or state is empty and required")
+	}
+
+	provider, err := oidc.GetProvider(c.Params("provider"))
+	if err != nil {
+		return provider, oidc.Identity{}, 404, err
+	}
+
+	oidcState, err := consumeOIDCState(provider, data["state"], linkUser)
+	if err != nil {
+		return provider, oidc.Identity{}, 400, err
+	}
+
+	identity, err := provider.Exchange(data["code"], oidcState.Nonce, oidcState.CodeVerifier)
+	if err != nil {
+		log.Printf("controller#finishOIDC: %v", err)
+		return provider, identity, 401, errors.New("The identity provider login could not be verified")
+	}
+	return provider, identity, 200, nil
+}
+
+/*
+* Picks an unused username for an account created through an identity provider.
+*
+* @param identity The verified identity.
+*
+* @return string The username.
+* @return error The error message, if no unused username was found.
+ */
+func oidcUsername(identity oidc.Identity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base = strings.Split(identity.Email, "@")[0]
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if len(base) > 14 {
+		base = base[:14]
+	}
+	for len(base) < 4 {
+		base += "_"
+	}
+
+	username := base
+	for i := 0; i < 10; i++ {
+		var existing models.User
+		if db.DB.Where("username = ?", username).First(&existing).Error == gorm.ErrRecordNotFound {
+			return username, nil
+		}
+		username = base + strconv.Itoa(100000+rand.Intn(900000))
+	}
+	return "", errOIDCUsername
+}
+
+/*
+* Returns the identity providers that can be used to log in.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OIDCProviders(c *fiber.Ctx) error {
+	providersDTO := DTO("providers", oidc.ProviderNames())
+	return Success(c, "Providers returned", providersDTO)
+}
+
+/*
+* Starts a login with an identity provider.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OIDCLoginStart(c *fiber.Ctx) error {
+	provider, err := oidc.GetProvider(c.Params("provider"))
+	if err != nil {
+		return Error(c, 404, err.Error())
+	}
+	return startOIDC(c, provider, 0)
+}
+
+/*
+* Completes a login with an identity provider, creating an account on the first login.
+* An identity whose email belongs to an existing account is not linked automatically,
+* the user has to log in and link it from their account instead.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OIDCLoginCallback(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	provider, identity, code, err := finishOIDC(c, data, 0)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Log in with the linked account
+	var linked models.ExternalIdentity
+	result := db.DB.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).First(&linked)
+	if result.Error == nil {
+		var user models.User
+		result = db.DB.Where("user_uid = ?", linked.IdentityUser).First(&user)
+		code, err := RecordExists("User", result)
+		if err != nil {
+			return Error(c, code, err.Error())
+		}
+
+		if user.TOTPEnabled {
+			return loginChallenge(c, user)
+		}
+		return completeLogin(c, user, data["deviceName"])
+	}
+
+	// Create a new account for an unknown identity
+	if identity.Email == "" {
+		return Error(c, 400, "The identity provider did not share an email address")
+	}
+
+	var existing models.User
+	result = db.DB.Where("email = ?", identity.Email).First(&existing)
+	if result.Error == nil {
+		return Error(c, 409, "An account with this email already exists, log in and link the identity instead", DTO("reason", "account_exists"))
+	}
+
+	username, err := oidcUsername(identity)
+	if err != nil {
+		log.Printf("controller#OIDCLoginCallback: %v", err)
+		return Error(c, 500, "There was an error creating the user")
+	}
+	user := models.User{
+		Username:     username,
+		Email:        identity.Email,
+		EmailConfirm: strconv.FormatBool(identity.EmailVerified),
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := createUser(tx, &user); err != nil {
+			return err
+		}
+		return tx.Create(&models.ExternalIdentity{
+			IdentityUser: user.UserUID,
+			Provider:     provider.Name,
+			Issuer:       identity.Issuer,
+			Subject:      identity.Subject,
+			Email:        identity.Email,
+		}).Error
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error creating the user")
+	}
+
+	if !identity.EmailVerified {
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("controller#OIDCLoginCallback: Error sending verification email: %v", err)
+		}
+	}
+
+	return completeLogin(c, user, data["deviceName"])
+}
+
+/*
+* Returns the identities linked to the users account.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OIDCIdentities(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	var identities []models.ExternalIdentity
+	db.DB.Where("identity_user = ?", user.UserUID).Find(&identities)
+
+	identitiesDTO := DTO("identities", identities)
+	return Success(c, "Identities returned", identitiesDTO)
+}
+
+/*
+* Starts linking an identity provider to the users account.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OIDCLinkStart(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	provider, err := oidc.GetProvider(c.Params("provider"))
+	if err != nil {
+		return Error(c, 404, err.Error())
+	}
+	return startOIDC(c, provider, user.UserUID)
+}
+
+/*
+* Completes linking an identity provider to the users account.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OIDCLinkCallback(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	provider, identity, code, err := finishOIDC(c, data, user.UserUID)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	var linked models.ExternalIdentity
+	result := db.DB.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).First(&linked)
+	code, err = recordNotInUse("Identity", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	linked = models.ExternalIdentity{
+		IdentityUser: user.UserUID,
+		Provider:     provider.Name,
+		Issuer:       identity.Issuer,
+		Subject:      identity.Subject,
+		Email:        identity.Email,
+	}
+	db.DB.Create(&linked)
+
+	identityDTO := DTO("identity", linked)
+	return Success(c, "Identity was successfully linked", identityDTO)
+}
+
+/*
+* Removes a linked identity from the users account.
+* The last identity of an account without a password cannot be removed.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OIDCUnlink(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	identityUID := c.Query("identityUID")
+
+	// Validate identity
+	var identity models.ExternalIdentity
+	result := db.DB.Where("identity_uid = ? AND identity_user = ?", identityUID, user.UserUID).First(&identity)
+	code, err := RecordExists("Identity", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	var count int64
+	db.DB.Model(&models.ExternalIdentity{}).Where("identity_user = ?", user.UserUID).Count(&count)
+	if user.Hash == "" && count <= 1 {
+		return Error(c, 400, "Cannot remove the only way to log in to this account, set a password with a password reset first")
+	}
+
+	db.DB.Delete(&identity)
+
+	return Success(c, "Identity was successfully unlinked")
+}
@@ -18,8 +18,13 @@ import (
 * @return error The error message, if there is any.
  */
 func OwnershipQuantity(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	ownershipUID := c.Query("ownershipUID")
 	amountStr := c.Query("amount")
 	changeType := c.Params("type")
@@ -35,13 +40,14 @@ func OwnershipQuantity(c *fiber.Ctx) error {
 
 	// Valide and retreive the ownership
 	var ownership models.Ownership
-	result := db.DB.Where("ownership_uid = ? AND item_owner = ?", ownershipUID, user.UserUID).First(&ownership)
+	result := db.DB.Where("ownership_uid = ? AND item_household = ?", ownershipUID, household.HouseholdUID).First(&ownership)
 	code, err := RecordExists("Ownership", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
 	// Check type of change
+	before := ownership
 	switch changeType {
 	case "increment":
 		ownership.ItemQuantity += amount
@@ -61,6 +67,8 @@ func OwnershipQuantity(c *fiber.Ctx) error {
 
 	// Save new amount to the database and create response
 	db.DB.Save(&ownership)
+	recordAudit(c, household.HouseholdUID, "ownership.quantity", "ownership", ownership.OwnershipUID, before, ownership)
+	recordQuantityChange(c, before.ItemQuantity, ownership)
 
 	preloadOwnership(&ownership)
 
@@ -69,34 +77,39 @@ func OwnershipQuantity(c *fiber.Ctx) error {
 }
 
 /*
-* Deletes an ownership from the database.
+* Moves an ownership to the trash.
 *
 * @param c The Fiber context containing the HTTP request and response objects.
 *
 * @return error The error message, if there is any.
  */
 func OwnershipDelete(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	ownershipUID := c.Query("ownershipUID")
 
 	// Validate ownership
 	var ownership models.Ownership
-	result := db.DB.Where("ownership_uid = ? AND item_owner = ?", ownershipUID, user.UserUID).First(&ownership)
+	result := db.DB.Where("ownership_uid = ? AND item_household = ?", ownershipUID, household.HouseholdUID).First(&ownership)
 	code, err := RecordExists("Ownership", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
-	db.DB.Delete(&ownership)
-
-	// Check for errors after the delete operation
+	// Move the ownership to the trash, it is purged once the retention period has passed
 	if result := db.DB.Delete(&ownership); result.Error != nil {
 		return Error(c, 500, "There was an error deleting the ownership")
 	}
+	recordAudit(c, household.HouseholdUID, "ownership.delete", "ownership", ownership.OwnershipUID, ownership, nil)
+	recordOwnershipEvent(c, ownership, models.OwnershipDeleted, "Moved to the trash", "", "")
 
 	// Ownership successfully deleted
-	return Success(c, "Ownership was successfully deleted")
+	return Success(c, "Ownership was moved to the trash")
 }
 
 /*
@@ -107,8 +120,13 @@ func OwnershipDelete(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
  */
 func OwnershipEdit(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	ownershipUID := c.Query("ownershipUID")
 
 	// Parse request into data map
@@ -120,14 +138,23 @@ func OwnershipEdit(c *fiber.Ctx) error {
 
 	// Validate ownership
 	var ownership models.Ownership
-	result := db.DB.Where("ownership_uid = ? AND item_owner = ?", ownershipUID, user.UserUID).First(&ownership)
+	result := db.DB.Where("ownership_uid = ? AND item_household = ?", ownershipUID, household.HouseholdUID).First(&ownership)
 	code, err := RecordExists("Ownership", result)
 
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
+	// Enforce the image storage of the household owners tier
+	owner := householdOwner(household)
+	tier := userTier(owner)
+	added := int64(len(data["customItemImg"]) - len(ownership.CustItemImg))
+	if added > 0 && !withinQuota(tier.ImageStorageBytes, imageStorageUsed(owner), added) {
+		return quotaExceeded(c, "bytes of image storage", tier.ImageStorageBytes)
+	}
+
 	// Add new fields
+	before := ownership
 	ownership.CustomItemName = data["customItemName"]
 	ownership.CustItemImg = data["customItemImg"]
 	ownership.OwnedCustDesc = data["customItemDescription"]
@@ -135,6 +162,8 @@ func OwnershipEdit(c *fiber.Ctx) error {
 	ownership.ItemQR = data["qr"]
 
 	db.DB.Save(&ownership)
+	recordAudit(c, household.HouseholdUID, "ownership.edit", "ownership", ownership.OwnershipUID, before, ownership)
+	recordOwnershipEdit(c, before, ownership)
 
 	// Ownership successfully updated
 	return Success(c, "Ownership was successfully updated")
@@ -148,6 +177,11 @@ func OwnershipEdit(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
  */
 func OwnershipCreateNoItem(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Parse request into data map
 	var data map[string]string
 	err := c.BodyParser(&data)
@@ -156,6 +190,7 @@ func OwnershipCreateNoItem(c *fiber.Ctx) error {
 	}
 
 	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	qr := data["qr"]
 	name := data["name"]
 	
@@ -163,21 +198,28 @@ func OwnershipCreateNoItem(c *fiber.Ctx) error {
 		return Error(c, 400, "Missing field qr or name")
 	}
 
+	// Enforce the ownership limit of the household owners tier
+	owner := householdOwner(household)
+	tier := userTier(owner)
+	if !withinQuota(tier.MaxOwnerships, ownershipCount(owner), 1) {
+		return quotaExceeded(c, "ownerships", tier.MaxOwnerships)
+	}
+
 	var ownershipCheck models.Ownership
-	result := db.DB.Where("item_qr = ? AND item_owner = ?", qr, user.UserUID).First(&ownershipCheck)
+	result := db.DB.Where("item_qr = ? AND item_household = ?", qr, household.HouseholdUID).First(&ownershipCheck)
 	code, err := recordNotInUse("Ownership", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
 	var locationCheck models.Location
-	result = db.DB.Where("location_qr = ? AND location_owner = ?", qr, user.UserUID).First(&locationCheck)
+	result = db.DB.Where("location_qr = ? AND location_household = ?", qr, household.HouseholdUID).First(&locationCheck)
 	code, err = recordNotInUse("Location", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
-	result = db.DB.Where("custom_item_name = ? AND item_owner = ?", name, user.UserUID).First(&ownershipCheck)
+	result = db.DB.Where("custom_item_name = ? AND item_household = ?", name, household.HouseholdUID).First(&ownershipCheck)
 	code, err = recordNotInUse("Ownership", result)
 	if err != nil {
 		return Error(c, code, err.Error())
@@ -190,10 +232,12 @@ func OwnershipCreateNoItem(c *fiber.Ctx) error {
 		return Error(c, code, err.Error())
 	}
 
-	ownership, err := createOwnership(user.UserUID, item, qr, name)
+	ownership, err := createOwnership(user.UserUID, household.HouseholdUID, item, qr, name)
 	if err != nil {
 		return Error(c, 400, err.Error())
 	}
+	recordAudit(c, household.HouseholdUID, "ownership.create", "ownership", ownership.OwnershipUID, nil, ownership)
+	recordOwnershipEvent(c, ownership, models.OwnershipCreated, "Created as "+ownership.CustomItemName, "", ownership.CustomItemName)
 
 	preloadOwnership(&ownership)
 	ownershipDTO := DTO("ownership", ownership)
@@ -208,14 +252,19 @@ func OwnershipCreateNoItem(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
  */
 func OwnershipSetLocation(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	locationQR := c.Query("location_qr")
 	ownershipUID := c.Query("ownershipUID")
 
 	// Validate the QR code
 	var location models.Location
-	result := db.DB.Where("location_qr = ? AND location_owner = ?", locationQR, user.UserUID).First(&location)
+	result := db.DB.Where("location_qr = ? AND location_household = ?", locationQR, household.HouseholdUID).First(&location)
 	code, err := RecordExists("Location QR", result)
 	if err != nil {
 		return Error(c, code, err.Error())
@@ -223,15 +272,19 @@ func OwnershipSetLocation(c *fiber.Ctx) error {
 
 	// Validate the ownership
 	var ownership models.Ownership
-	result = db.DB.Where("ownership_uid = ? AND item_owner = ?", ownershipUID, user.UserUID).First(&ownership)
+	result = db.DB.Where("ownership_uid = ? AND item_household = ?", ownershipUID, household.HouseholdUID).First(&ownership)
 	code, err = RecordExists("Ownership", result)
 	if err != nil {
 		return Error(c, code, err.Error())
 	}
 
 	// Set the location and save
+	before := ownership
 	ownership.ItemLocation = location.LocationUID
 	db.DB.Save(&ownership)
+	recordAudit(c, household.HouseholdUID, "ownership.set_location", "ownership", ownership.OwnershipUID, before, ownership)
+	from := locationName(before.ItemLocation)
+	recordOwnershipEvent(c, ownership, models.OwnershipMoved, "Moved from "+from+" to "+location.LocationName, from, location.LocationName)
 
 	// return success
 	return Success(c, "Ownership set in "+location.LocationName)
@@ -245,8 +298,14 @@ func OwnershipSetLocation(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
 */
 func OwnershipSearch(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionView)
+	if !allowed {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	var data map[string]string
 	err := c.BodyParser(&data)
 	if err != nil {
@@ -258,7 +317,10 @@ func OwnershipSearch(c *fiber.Ctx) error {
 
 	tagsFormat := strings.Split(strings.TrimSpace(tags), ",")
 
-	query := db.DB.Where("item_owner = ? AND custom_item_name LIKE ?", user.UserUID, "%"+name+"%")
+	query := db.DB.Where("item_household = ? AND custom_item_name LIKE ?", household.HouseholdUID, "%"+name+"%")
+	if limited {
+		query = query.Where("item_location IN ?", scope)
+	}
 
 	for _, tag := range tagsFormat {
 		query = query.Where("item_tags LIKE ?", "%"+tag+"%")
@@ -268,9 +330,7 @@ func OwnershipSearch(c *fiber.Ctx) error {
 		return Error(c, 404, "Not found")
 	}
 	
-	for i := range ownerships {
-		preloadOwnership(&ownerships[i])
-	}
+	preloadOwnerships(ownerships)
 
 	ownershipDTO := DTO("ownership", ownerships)
 	return Success(c, "Items found", ownershipDTO)
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/*
+* Appends an event to the history of an ownership.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param ownership The ownership the event happened to.
+* @param eventType The kind of event, e.g. models.OwnershipMoved.
+* @param summary The sentence shown in the timeline.
+* @param from The value before the event, if there is one.
+* @param to The value after the event, if there is one.
+ */
+func recordOwnershipEvent(c *fiber.Ctx, ownership models.Ownership, eventType string, summary string, from string, to string) {
+	user, _ := c.Locals("user").(models.User)
+
+	event := models.OwnershipEvent{
+		EventOwnership: ownership.OwnershipUID,
+		EventHousehold: ownership.ItemHousehold,
+		EventType:      eventType,
+		Actor:          user.UserUID,
+		Summary:        summary,
+		FromValue:      from,
+		ToValue:        to,
+	}
+	if err := db.DB.Create(&event).Error; err != nil {
+		log.Printf("controller#recordOwnershipEvent: Error recording %s of ownership %d: %v", eventType, ownership.OwnershipUID, err)
+	}
+}
+
+/*
+* Looks up the name of a location for the history of an ownership.
+*
+* @param locationUID The locations UID.
+*
+* @return string The location name.
+ */
+func locationName(locationUID uint) string {
+	var location models.Location
+	db.DB.Unscoped().Select("location_name").Where("location_uid = ?", locationUID).First(&location)
+	return location.LocationName
+}
+
+/*
+* Looks up the name of a borrower for the history of an ownership.
+*
+* @param borrowerUID The borrowers UID.
+*
+* @return string The borrower name.
+ */
+func borrowerName(borrowerUID uint) string {
+	var borrower models.Borrower
+	db.DB.Select("borrower_name").Where("borrower_uid = ?", borrowerUID).First(&borrower)
+	return borrower.BorrowerName
+}
+
+/*
+* Lists the fields that differ between two versions of an ownership.
+*
+* @param before The ownership before it was edited.
+* @param after The ownership after it was edited.
+*
+* @return []string The names of the changed fields.
+ */
+func editedFields(before models.Ownership, after models.Ownership) []string {
+	fields := []string{}
+	if before.CustomItemName != after.CustomItemName {
+		fields = append(fields, "name")
+	}
+	if before.CustItemImg != after.CustItemImg {
+		fields = append(fields, "image")
+	}
+	if before.OwnedCustDesc != after.OwnedCustDesc {
+		fields = append(fields, "description")
+	}
+	if before.ItemTags != after.ItemTags {
+		fields = append(fields, "tags")
+	}
+	if before.ItemQR != after.ItemQR {
+		fields = append(fields, "QR code")
+	}
+	return fields
+}
+
+/*
+* Records the history event of an edit, if anything was changed.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param before The ownership before it was edited.
+* @param after The ownership after it was edited.
+ */
+func recordOwnershipEdit(c *fiber.Ctx, before models.Ownership, after models.Ownership) {
+	fields := editedFields(before, after)
+	if len(fields) == 0 {
+		return
+	}
+	recordOwnershipEvent(c, after, models.OwnershipEdited, "Changed the "+strings.Join(fields, ", "), "", "")
+}
+
+/*
+* Records the history event of a quantity change.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param before The quantity before the change.
+* @param after The ownership after the change.
+ */
+func recordQuantityChange(c *fiber.Ctx, before int, after models.Ownership) {
+	if before == after.ItemQuantity {
+		return
+	}
+	from := strconv.Itoa(before)
+	to := strconv.Itoa(after.ItemQuantity)
+	recordOwnershipEvent(c, after, models.OwnershipQuantity, "Quantity changed from "+from+" to "+to, from, to)
+}
+
+/*
+* Returns the timeline of a single ownership, oldest event first.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func OwnershipHistory(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionView)
+	if !allowed {
+		return permissionError(c, permissionView)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+
+	// Validate ownership, the history of ownerships in the trash can still be viewed
+	var ownership models.Ownership
+	result := db.DB.Unscoped().Where("ownership_uid = ? AND item_household = ?", c.Params("id"), household.HouseholdUID).First(&ownership)
+	code, err := RecordExists("Ownership", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if limited && !containsLocation(ownership.ItemLocation, scope) {
+		return Error(c, 404, "Ownership was not found in the database")
+	}
+
+	var events []models.OwnershipEvent
+	db.DB.Preload("User").Where("event_ownership = ?", ownership.OwnershipUID).Order("created_at, event_uid").Find(&events)
+	for i := range events {
+		events[i].ActorName = events[i].User.Username
+	}
+
+	eventsDTO := DTO("history", events)
+	return Success(c, "History returned", eventsDTO)
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/mailer"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The purpose of an action token that allows a user to choose a new password.
+const purposeResetPassword = "reset_password"
+
+/*
+* Sends the user an email containing a one-time link to reset their password.
+*
+* @param user The user to send the email to.
+*
+* @return error The error message, if there is one.
+ */
+func sendPasswordResetEmail(user models.User) error {
+	token, err := issueActionToken(user, purposeResetPassword, utils.EnvDuration("PASSWORD_RESET_LIFETIME", time.Hour))
+	if err != nil {
+		return err
+	}
+
+	body := "Hi " + user.Username + ",\n\n" +
+		"A password reset was requested for your WIG account. Open the link below to choose a new password:\n\n" +
+		appLink("reset", token) + "\n\n" +
+		"The link can only be used once. If you did not request a reset you can ignore this email."
+
+	return mailer.Send(user.Email, "Reset your WIG password", body)
+}
+
+/*
+* Emails a password reset link to the account with the given email or username.
+* The response is the same whether or not the account exists, so it cannot be used to discover accounts.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserForgot(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["email"] == "" && data["username"] == "" {
+		return Error(c, 400, "Email or username is empty and required")
+	}
+
+	var user models.User
+	result := db.DB.Where("email = ?", data["email"]).First(&user)
+	if data["email"] == "" {
+		result = db.DB.Where("username = ?", data["username"]).First(&user)
+	}
+
+	if result.Error == nil {
+		// Only send one email per EMAIL_RESEND_INTERVAL
+		var last models.ActionToken
+		result = db.DB.Where("token_user = ? AND token_purpose = ?", user.UserUID, purposeResetPassword).Order("created_at DESC").First(&last)
+		if result.Error != nil || time.Since(last.CreatedAt) >= utils.EnvDuration("EMAIL_RESEND_INTERVAL", time.Minute) {
+			if err := sendPasswordResetEmail(user); err != nil {
+				log.Printf("controller#UserForgot: Error sending password reset email: %v", err)
+			}
+		}
+	}
+
+	return Success(c, "If the account exists a password reset email has been sent")
+}
+
+/*
+* Sets a new salt and hash for the user with a password reset token.
+* All sessions of the user are revoked, so every device has to log in again, and any login lockout is lifted.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserReset(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["token"] == "" {
+		return Error(c, 400, "Token is empty and required")
+	}
+	if data["salt"] == "" || data["hash"] == "" {
+		return Error(c, 400, "Salt or hash is empty and required")
+	}
+
+	user, err := consumeActionToken(data["token"], purposeResetPassword)
+	if err != nil {
+		return actionTokenError(c, err)
+	}
+
+	hash, err := utils.HashPassword(data["hash"])
+	if err != nil {
+		return Error(c, 500, "There was an error hashing the password")
+	}
+
+	db.DB.Model(&user).Updates(map[string]interface{}{"salt": data["salt"], "hash": hash})
+	revokeUserSessions(user.UserUID, 0)
+	resetLoginThrottle(user.Username)
+
+	return Success(c, "Password was successfully reset")
+}
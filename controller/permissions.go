@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"WIG-Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The actions a household role can be allowed to take.
+const (
+	permissionView   = "view"
+	permissionEdit   = "edit"
+	permissionBorrow = "borrow"
+	permissionManage = "manage"
+)
+
+// The permissions granted to each household role.
+var rolePermissions = map[string][]string{
+	models.HouseholdOwner:      {permissionView, permissionEdit, permissionBorrow, permissionManage},
+	models.HouseholdEditor:     {permissionView, permissionEdit, permissionBorrow},
+	models.HouseholdViewer:     {permissionView},
+	models.HouseholdBorrowOnly: {permissionView, permissionBorrow},
+}
+
+/*
+* Checks whether a household role grants a permission.
+*
+* @param role The role, e.g. "editor".
+* @param permission The permission, e.g. "edit".
+*
+* @return bool Whether the role grants the permission.
+ */
+func rolePermits(role string, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* Checks whether the users role in the household of the request grants a permission.
+* Relies on the membership set by the ResolveHousehold middleware.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param permission The permission, e.g. "edit".
+*
+* @return bool Whether the user has the permission.
+ */
+func hasPermission(c *fiber.Ctx, permission string) bool {
+	membership, ok := c.Locals("membership").(models.Membership)
+	return ok && rolePermits(membership.MemberRole, permission)
+}
+
+/*
+* Returns a 403 response for a user whose household role does not grant a permission.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param permission The permission that was missing.
+*
+* @return error The c.Status being returned via fiber.
+ */
+func permissionError(c *fiber.Ctx, permission string) error {
+	return Error(c, 403, "Your role in this household does not allow this", DTO("reason", "permission_denied"), DTO("requiredPermission", permission))
+}
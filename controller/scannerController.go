@@ -22,8 +22,14 @@ import (
 * @return error The error message, if there is any.
  */
 func ScanBarcode(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionView) {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
 	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	barcode := c.Query("barcode")
 
 	// Validate barcode
@@ -36,12 +42,27 @@ func ScanBarcode(c *fiber.Ctx) error {
 	}
 
 	// Check if item exists in local database
+	owner := householdOwner(household)
+	tier := userTier(owner)
 	var item models.Item
 	result := db.DB.Where("barcode = ?", barcode).First(&item)
 
 	// If item isn't found, check api and add to
 	if result.Error == gorm.ErrRecordNotFound {
 		log.Println("Record not found")
+
+		// A new item always needs a new ownership, so only use up a lookup when one can be created
+		if !hasPermission(c, permissionEdit) {
+			return permissionError(c, permissionEdit)
+		}
+		if !withinQuota(tier.MaxOwnerships, ownershipCount(owner), 1) {
+			return quotaExceeded(c, "ownerships", tier.MaxOwnerships)
+		}
+		if !withinQuota(tier.BarcodeLookupsPerDay, barcodeLookupsToday(owner), 1) {
+			return quotaExceeded(c, "barcode lookups per day", tier.BarcodeLookupsPerDay)
+		}
+		recordBarcodeLookup(owner)
+
 		limit := upcitemdb.GetBarcode(barcode)
 		if limit == 429 {
 			return Error(c, limit, "API limit reached")
@@ -60,21 +81,27 @@ func ScanBarcode(c *fiber.Ctx) error {
 
 	// Search Ownership by uid
 	var ownerships []models.Ownership
-	db.DB.Where("item_number = ? AND item_owner = ?", item.ItemUid, user.UserUID).Find(&ownerships)
+	db.DB.Where("item_number = ? AND item_household = ?", item.ItemUid, household.HouseholdUID).Find(&ownerships)
 
 	// If no ownership exists, create ownership
 	if len(ownerships) == 0 {
-		ownership, err := createOwnership(user.UserUID, item, "", "")
+		if !hasPermission(c, permissionEdit) {
+			return permissionError(c, permissionEdit)
+		}
+		if !withinQuota(tier.MaxOwnerships, ownershipCount(owner), 1) {
+			return quotaExceeded(c, "ownerships", tier.MaxOwnerships)
+		}
+		ownership, err := createOwnership(user.UserUID, household.HouseholdUID, item, "", "")
 		
 		if err != nil {
 			return Error(c, 400, err.Error())
 		}
+		recordAudit(c, household.HouseholdUID, "ownership.create", "ownership", ownership.OwnershipUID, nil, ownership)
+		recordOwnershipEvent(c, ownership, models.OwnershipCreated, "Created from a scan of barcode "+barcode, "", barcode)
 		ownerships = append(ownerships, ownership)
 	}
 
-	for i := range ownerships {
-		preloadOwnership(&ownerships[i])
-	}
+	preloadOwnerships(ownerships)
 
 	ownershipDTO := DTO("ownership", ownerships)
 
@@ -89,8 +116,14 @@ func ScanBarcode(c *fiber.Ctx) error {
 * @return error The error message, if there is any.
  */
 func ScanCheckQR(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionView)
+	if !allowed {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	qr := c.Query("qr")
 
 	// Check for empty fields
@@ -100,7 +133,11 @@ func ScanCheckQR(c *fiber.Ctx) error {
 
 	// Check if qr exists as location
 	var location models.Location
-	result := db.DB.Where("location_qr = ? AND location_owner = ?", qr, user.UserUID).First(&location)
+	query := db.DB.Where("location_qr = ? AND location_household = ?", qr, household.HouseholdUID)
+	if limited {
+		query = query.Where("location_uid IN ?", scope)
+	}
+	result := query.First(&location)
 	if location.LocationUID != 0 {
 		return Success(c, "LOCATION")
 	} else if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
@@ -109,7 +146,11 @@ func ScanCheckQR(c *fiber.Ctx) error {
 
 	// Check if qr exists as ownership
 	var ownership models.Ownership
-	result = db.DB.Where("item_qr = ? AND item_owner = ?", qr, user.UserUID).First(&ownership)
+	query = db.DB.Where("item_qr = ? AND item_household = ?", qr, household.HouseholdUID)
+	if limited {
+		query = query.Where("item_location IN ?", scope)
+	}
+	result = query.First(&ownership)
 	if ownership.OwnershipUID != 0 {
 		return Success(c, "OWNERSHIP")
 	}
@@ -121,8 +162,14 @@ func ScanCheckQR(c *fiber.Ctx) error {
 }
 
 func ScanQRLocation(c *fiber.Ctx) error {
+	// Check the users household role, or the locations shared with them
+	scope, limited, allowed := accessScope(c, permissionView)
+	if !allowed {
+		return permissionError(c, permissionView)
+	}
+
 	// Initialize variables
-	user := c.Locals("user").(models.User)
+	household := c.Locals("household").(models.Household)
 	qr := c.Query("qr")
 
 	// Validate qr
@@ -132,7 +179,11 @@ func ScanQRLocation(c *fiber.Ctx) error {
 
 	// Check if item exists in local database
 	var location models.Location
-	result := db.DB.Where("location_qr = ? AND location_owner = ?", qr, user.UserUID).First(&location)
+	query := db.DB.Where("location_qr = ? AND location_household = ?", qr, household.HouseholdUID)
+	if limited {
+		query = query.Where("location_uid IN ?", scope)
+	}
+	result := query.First(&location)
 
 	if result.Error == gorm.ErrRecordNotFound {
 		return Error(c, 400, "Item was not found in the database")
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Returned inside of a refresh transaction when the token was exchanged concurrently.
+var errRefreshReused = errors.New("refresh token has already been used")
+
+/*
+* Creates a new session for the device making the request and returns its tokens to the application.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param user The user that has been authenticated.
+* @param deviceName The name the application gave the device, if any.
+*
+* @return error The error message, if there is any.
+ */
+func completeLogin(c *fiber.Ctx, user models.User, deviceName string) error {
+	if user.Disabled {
+		return accountDisabledError(c)
+	}
+
+	// Failed logins are only forgiven once every factor has been checked
+	resetLoginThrottle(user.Username)
+
+	// Logging in cancels a scheduled account deletion
+	if user.DeletionScheduledAt != nil {
+		db.DB.Model(&user).Update("deletion_scheduled_at", nil)
+		log.Printf("controller#completeLogin: Scheduled deletion of user %d was cancelled", user.UserUID)
+	}
+
+	session := models.Session{
+		SessionUser: user.UserUID,
+		DeviceName:  deviceName,
+		UserAgent:   c.Get("User-Agent"),
+		IPAddress:   c.IP(),
+		LastSeen:    time.Now(),
+	}
+
+	var token, refreshToken string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		token, err = utils.GenerateToken(user.UserUID, session.SessionUID, user.Username)
+		if err != nil {
+			return err
+		}
+
+		refreshToken, err = issueRefreshToken(tx, session)
+		return err
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error generating user token")
+	}
+
+	tokenDTO := DTO("token", token)
+	refreshDTO := DTO("refreshToken", refreshToken)
+	uidDTO := DTO("uid", user.UserUID)
+	sessionDTO := DTO("sessionUID", session.SessionUID)
+
+	return Success(c, "Login was successful", tokenDTO, refreshDTO, uidDTO, sessionDTO)
+}
+
+/*
+* Creates and stores a new refresh token for a session.
+*
+* @param tx The database connection or transaction to store the token with.
+* @param session The session the refresh token belongs to.
+*
+* @return string The refresh token to return to the application.
+* @return error The error message, if there is one.
+ */
+func issueRefreshToken(tx *gorm.DB, session models.Session) (string, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	refresh := models.RefreshToken{
+		TokenUser:    session.SessionUser,
+		TokenSession: session.SessionUID,
+		TokenHash:    utils.HashToken(token),
+		ExpiresAt:    time.Now().Add(utils.RefreshTokenLifetime()),
+	}
+	if err := tx.Create(&refresh).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+/*
+* Revokes a session along with all of its refresh tokens.
+*
+* @param sessionUID The UID of the session to revoke.
+ */
+func revokeSession(sessionUID uint) {
+	now := time.Now()
+	db.DB.Model(&models.Session{}).
+		Where("session_uid = ? AND revoked_at IS NULL", sessionUID).
+		Update("revoked_at", &now)
+	db.DB.Model(&models.RefreshToken{}).
+		Where("token_session = ? AND revoked_at IS NULL", sessionUID).
+		Update("revoked_at", &now)
+	log.Printf("controller#revokeSession: Session %d was revoked", sessionUID)
+}
+
+/*
+* Revokes every session and personal access token of a user, logging out all of their devices.
+* Personal access tokens are always revoked, as they are not tied to a session.
+*
+* @param uid The users UID.
+* @param except The UID of a session to keep, or 0 to revoke all of them.
+ */
+func revokeUserSessions(uid uint, except uint) {
+	now := time.Now()
+	db.DB.Model(&models.Session{}).
+		Where("session_user = ? AND session_uid <> ? AND revoked_at IS NULL", uid, except).
+		Update("revoked_at", &now)
+	db.DB.Model(&models.RefreshToken{}).
+		Where("token_user = ? AND token_session <> ? AND revoked_at IS NULL", uid, except).
+		Update("revoked_at", &now)
+	db.DB.Model(&models.PersonalAccessToken{}).
+		Where("pat_user = ? AND revoked_at IS NULL", uid).
+		Update("revoked_at", &now)
+	log.Printf("controller#revokeUserSessions: Sessions and access tokens of user %d were revoked", uid)
+}
+
+/*
+* Returns all active sessions of the user.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserSessions(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	current := c.Locals("session").(models.Session)
+
+	var sessions []models.Session
+	db.DB.Where("session_user = ? AND revoked_at IS NULL", user.UserUID).Order("last_seen DESC").Find(&sessions)
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionUID == current.SessionUID
+	}
+
+	sessionsDTO := DTO("sessions", sessions)
+	return Success(c, "Sessions returned", sessionsDTO)
+}
+
+/*
+* Revokes one of the users sessions, logging that device out.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserSessionRevoke(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+	sessionUID := c.Query("sessionUID")
+
+	// Validate session
+	var session models.Session
+	result := db.DB.Where("session_uid = ? AND session_user = ? AND revoked_at IS NULL", sessionUID, user.UserUID).First(&session)
+	code, err := RecordExists("Session", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	revokeSession(session.SessionUID)
+
+	return Success(c, "Session was successfully revoked")
+}
+
+/*
+* Revokes the session making the request.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserLogout(c *fiber.Ctx) error {
+	session := c.Locals("session").(models.Session)
+
+	revokeSession(session.SessionUID)
+
+	return Success(c, "Logout was successful")
+}
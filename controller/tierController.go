@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+* Returns the tier of a user, falling back to DEFAULT_TIER for users without a known tier.
+*
+* @param user The user.
+*
+* @return models.Tier The users tier.
+ */
+func userTier(user models.User) models.Tier {
+	if tier, ok := models.Tiers[user.Tier]; ok {
+		return tier
+	}
+
+	godotenv.Load()
+	if tier, ok := models.Tiers[os.Getenv("DEFAULT_TIER")]; ok {
+		return tier
+	}
+	return models.Tiers["free"]
+}
+
+/*
+* Returns the owner of a household, whose tier applies to everything in the household.
+*
+* @param household The household.
+*
+* @return models.User The household owner.
+ */
+func householdOwner(household models.Household) models.User {
+	var owner models.User
+	db.DB.Where("user_uid = ?", household.HouseholdOwner).First(&owner)
+	return owner
+}
+
+/*
+* Builds a subquery of the households a user owns, the records in them count towards the users quotas.
+*
+* @param user The user.
+*
+* @return *gorm.DB The subquery selecting the household UIDs.
+ */
+func ownedHouseholds(user models.User) *gorm.DB {
+	return db.DB.Model(&models.Household{}).Select("household_uid").Where("household_owner = ?", user.UserUID)
+}
+
+/*
+* Returns the day barcode lookups are counted on.
+*
+* @return string The current day, e.g. "2006-01-02".
+ */
+func usageDay() string {
+	return time.Now().Format(time.DateOnly)
+}
+
+/*
+* Counts how much of each quota the user is using across the households they own.
+*
+* @param user The user.
+*
+* @return models.TierUsage The current usage.
+ */
+func tierUsage(user models.User) models.TierUsage {
+	return models.TierUsage{
+		Ownerships:          ownershipCount(user),
+		Locations:           locationCount(user),
+		Borrowers:           borrowerCount(user),
+		BarcodeLookupsToday: barcodeLookupsToday(user),
+		ImageStorageBytes:   imageStorageUsed(user),
+	}
+}
+
+/*
+* Counts the ownerships in the households a user owns.
+*
+* @param user The user.
+*
+* @return int64 The number of ownerships.
+ */
+func ownershipCount(user models.User) int64 {
+	var count int64
+	db.DB.Model(&models.Ownership{}).Where("item_household IN (?)", ownedHouseholds(user)).Count(&count)
+	return count
+}
+
+/*
+* Counts the locations in the households a user owns.
+*
+* @param user The user.
+*
+* @return int64 The number of locations.
+ */
+func locationCount(user models.User) int64 {
+	var count int64
+	db.DB.Model(&models.Location{}).Where("location_household IN (?)", ownedHouseholds(user)).Count(&count)
+	return count
+}
+
+/*
+* Counts the borrowers in the households a user owns.
+*
+* @param user The user.
+*
+* @return int64 The number of borrowers.
+ */
+func borrowerCount(user models.User) int64 {
+	var count int64
+	db.DB.Model(&models.Borrower{}).Where("borrower_household IN (?)", ownedHouseholds(user)).Count(&count)
+	return count
+}
+
+/*
+* Counts the barcode lookups made today in the households the user owns.
+*
+* @param user The user.
+*
+* @return int64 The number of lookups.
+ */
+func barcodeLookupsToday(user models.User) int64 {
+	var counter models.UsageCounter
+	db.DB.Where("counter_user = ? AND counter_day = ?", user.UserUID, usageDay()).First(&counter)
+	return counter.BarcodeLookups
+}
+
+/*
+* Adds one barcode lookup to the count for today of the household owner.
+*
+* @param user The user.
+ */
+func recordBarcodeLookup(user models.User) {
+	db.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"barcode_lookups": gorm.Expr("barcode_lookups + 1")}),
+	}).Create(&models.UsageCounter{CounterUser: user.UserUID, CounterDay: usageDay(), BarcodeLookups: 1})
+}
+
+/*
+* Sums the size of the custom images stored on the ownerships in the households a user owns.
+*
+* @param user The user.
+*
+* @return int64 The size in bytes.
+ */
+func imageStorageUsed(user models.User) int64 {
+	var used int64
+	db.DB.Model(&models.Ownership{}).Where("item_household IN (?)", ownedHouseholds(user)).
+		Select("COALESCE(SUM(LENGTH(custom_item_img)), 0)").Scan(&used)
+	return used
+}
+
+/*
+* Checks whether adding to a quota keeps it within its limit.
+*
+* @param limit The limit of the quota, negative for unlimited.
+* @param used The amount currently used.
+* @param adding The amount being added.
+*
+* @return bool Whether the quota allows the addition.
+ */
+func withinQuota(limit int64, used int64, adding int64) bool {
+	return limit < 0 || used+adding <= limit
+}
+
+/*
+* Returns a 403 response for a request that would exceed a quota of the household owners tier.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param resource The name of the quota, e.g. "ownerships".
+* @param limit The limit of the quota.
+*
+* @return error The c.Status being returned via fiber.
+ */
+func quotaExceeded(c *fiber.Ctx, resource string, limit int64) error {
+	return Error(c, 403, "The household owners tier allows at most "+strconv.FormatInt(limit, 10)+" "+resource,
+		DTO("reason", "quota_exceeded"), DTO("resource", resource), DTO("limit", limit))
+}
+
+/*
+* Returns the users tier limits along with their current usage across the households they own.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserUsage(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	tierDTO := DTO("tier", userTier(user))
+	usageDTO := DTO("usage", tierUsage(user))
+	return Success(c, "Usage returned", tierDTO, usageDTO)
+}
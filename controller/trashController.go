@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+/*
+* Returns how long deleted ownerships and locations stay in the trash before they are purged.
+*
+* @return time.Duration The retention period.
+ */
+func trashRetention() time.Duration {
+	return utils.EnvDuration("TRASH_RETENTION", 30*24*time.Hour)
+}
+
+/*
+* Permanently deletes an ownership from the trash along with its history.
+*
+* @param tx The transaction to delete the records in.
+* @param ownership The ownership to purge.
+*
+* @return error The error message, if there is one.
+ */
+func purgeOwnership(tx *gorm.DB, ownership models.Ownership) error {
+	if err := tx.Where("event_ownership = ?", ownership.OwnershipUID).Delete(&models.OwnershipEvent{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&ownership).Error
+}
+
+/*
+* Permanently deletes a location from the trash.
+* Anything still referencing the location, including records in the trash, is moved to the default location.
+*
+* @param tx The transaction to delete the records in.
+* @param location The location to purge.
+*
+* @return error The error message, if there is one.
+ */
+func purgeLocation(tx *gorm.DB, location models.Location) error {
+	if err := tx.Unscoped().Model(&models.Ownership{}).Where("item_location = ?", location.LocationUID).Update("item_location", 1).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(&models.Location{}).Where("location_parent = ?", location.LocationUID).Update("location_parent", 1).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("grant_location = ?", location.LocationUID).Delete(&models.LocationGrant{}).Error; err != nil {
+		return err
+	}
+	if err := removeLocationClosure(tx, location.LocationUID); err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&location).Error
+}
+
+/*
+* Checks that the QR code of a record being restored was not taken while it was in the trash.
+*
+* @param householdUID The UID of the household the record is restored in.
+* @param qr The QR code of the record.
+*
+* @return int The HTTP error code to return
+* @return error The error message, if there is one.
+ */
+func restoredQRNotInUse(householdUID uint, qr string) (int, error) {
+	if qr == "" {
+		return 200, nil
+	}
+
+	var ownershipCheck models.Ownership
+	result := db.DB.Where("item_qr = ? AND item_household = ?", qr, householdUID).First(&ownershipCheck)
+	if code, err := recordNotInUse("Ownership", result); err != nil {
+		return code, err
+	}
+
+	var locationCheck models.Location
+	result = db.DB.Where("location_qr = ? AND location_household = ?", qr, householdUID).First(&locationCheck)
+	return recordNotInUse("Location", result)
+}
+
+/*
+* Lists the ownerships and locations in the trash of the household, most recently deleted first.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func TrashList(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionView) {
+		return permissionError(c, permissionView)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+
+	var ownerships []models.Ownership
+	db.DB.Unscoped().Where("item_household = ? AND deleted_at IS NOT NULL", household.HouseholdUID).Order("deleted_at DESC").Find(&ownerships)
+
+	var locations []models.Location
+	db.DB.Unscoped().Where("location_household = ? AND deleted_at IS NOT NULL", household.HouseholdUID).Order("deleted_at DESC").Find(&locations)
+
+	ownershipsDTO := DTO("ownerships", ownerships)
+	locationsDTO := DTO("locations", locations)
+	retentionDTO := DTO("retention", trashRetention().String())
+	return Success(c, "Trash returned", ownershipsDTO, locationsDTO, retentionDTO)
+}
+
+/*
+* Restores an ownership or location from the trash, chosen with the ownershipUID or locationUID query.
+* Records whose location was deleted in the meantime are restored into the default location.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func TrashRestore(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionEdit) {
+		return permissionError(c, permissionEdit)
+	}
+
+	if c.Query("ownershipUID") != "" {
+		return restoreOwnership(c)
+	}
+	if c.Query("locationUID") != "" {
+		return restoreLocation(c)
+	}
+	return Error(c, 400, "Missing field ownershipUID or locationUID")
+}
+
+/*
+* Restores an ownership from the trash.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func restoreOwnership(c *fiber.Ctx) error {
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+
+	// Validate ownership
+	var ownership models.Ownership
+	result := db.DB.Unscoped().Where("ownership_uid = ? AND item_household = ? AND deleted_at IS NOT NULL", c.Query("ownershipUID"), household.HouseholdUID).First(&ownership)
+	code, err := RecordExists("Ownership", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Enforce the ownership limit of the household owners tier
+	owner := householdOwner(household)
+	tier := userTier(owner)
+	if !withinQuota(tier.MaxOwnerships, ownershipCount(owner), 1) {
+		return quotaExceeded(c, "ownerships", tier.MaxOwnerships)
+	}
+
+	code, err = restoredQRNotInUse(household.HouseholdUID, ownership.ItemQR)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Fall back to the default location when the location is gone
+	before := ownership
+	var location models.Location
+	if db.DB.Where("location_uid = ?", ownership.ItemLocation).First(&location).Error != nil {
+		ownership.ItemLocation = 1
+	}
+
+	result = db.DB.Unscoped().Model(&ownership).Updates(map[string]interface{}{
+		"item_location": ownership.ItemLocation,
+		"deleted_at":    nil,
+	})
+	if result.Error != nil {
+		return Error(c, 500, "There was an error restoring the ownership")
+	}
+	ownership.DeletedAt = gorm.DeletedAt{}
+	recordAudit(c, household.HouseholdUID, "ownership.restore", "ownership", ownership.OwnershipUID, before, ownership)
+	recordOwnershipEvent(c, ownership, models.OwnershipRestored, "Restored from the trash", "", "")
+
+	preloadOwnership(&ownership)
+	ownershipDTO := DTO("ownership", ownership)
+	return Success(c, "Ownership was restored", ownershipDTO)
+}
+
+/*
+* Restores a location from the trash.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func restoreLocation(c *fiber.Ctx) error {
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+
+	// Validate location
+	var location models.Location
+	result := db.DB.Unscoped().Where("location_uid = ? AND location_household = ? AND deleted_at IS NOT NULL", c.Query("locationUID"), household.HouseholdUID).First(&location)
+	code, err := RecordExists("Location", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Enforce the location limit of the household owners tier
+	owner := householdOwner(household)
+	tier := userTier(owner)
+	if !withinQuota(tier.MaxLocations, locationCount(owner), 1) {
+		return quotaExceeded(c, "locations", tier.MaxLocations)
+	}
+
+	code, err = restoredQRNotInUse(household.HouseholdUID, location.LocationQR)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+
+	// Fall back to the default location when the parent is gone, or would hold the location in a loop or too deep
+	before := location
+	parent := uint(1)
+	if location.Parent != nil && locationFits(household.HouseholdUID, location.LocationUID, *location.Parent) {
+		parent = *location.Parent
+	}
+	location.Parent = &parent
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&location).Updates(map[string]interface{}{
+			"location_parent": parent,
+			"deleted_at":      nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return moveLocationClosure(tx, location, parent)
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error restoring the location")
+	}
+	location.DeletedAt = gorm.DeletedAt{}
+	recordAudit(c, household.HouseholdUID, "location.restore", "location", location.LocationUID, before, location)
+
+	locationDTO := DTO("location", location)
+	return Success(c, "Location was restored", locationDTO)
+}
+
+/*
+* Permanently deletes an ownership or location from the trash, chosen with the ownershipUID or locationUID query.
+* Without either query the whole trash of the household is emptied.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func TrashPurge(c *fiber.Ctx) error {
+	// Check the users household role
+	if !hasPermission(c, permissionManage) {
+		return permissionError(c, permissionManage)
+	}
+
+	// Initialize variables
+	household := c.Locals("household").(models.Household)
+	ownershipUID := c.Query("ownershipUID")
+	locationUID := c.Query("locationUID")
+
+	ownershipQuery := db.DB.Unscoped().Where("item_household = ? AND deleted_at IS NOT NULL", household.HouseholdUID)
+	locationQuery := db.DB.Unscoped().Where("location_household = ? AND deleted_at IS NOT NULL", household.HouseholdUID)
+
+	var ownerships []models.Ownership
+	var locations []models.Location
+	switch {
+	case ownershipUID != "":
+		result := ownershipQuery.Where("ownership_uid = ?", ownershipUID).Find(&ownerships)
+		if result.RowsAffected == 0 {
+			return Error(c, 404, "Ownership was not found in the trash")
+		}
+	case locationUID != "":
+		result := locationQuery.Where("location_uid = ?", locationUID).Find(&locations)
+		if result.RowsAffected == 0 {
+			return Error(c, 404, "Location was not found in the trash")
+		}
+	default:
+		ownershipQuery.Find(&ownerships)
+		locationQuery.Find(&locations)
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, ownership := range ownerships {
+			if err := purgeOwnership(tx, ownership); err != nil {
+				return err
+			}
+		}
+		for _, location := range locations {
+			if err := purgeLocation(tx, location); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error emptying the trash")
+	}
+
+	for _, ownership := range ownerships {
+		recordAudit(c, household.HouseholdUID, "ownership.purge", "ownership", ownership.OwnershipUID, ownership, nil)
+	}
+	for _, location := range locations {
+		recordAudit(c, household.HouseholdUID, "location.purge", "location", location.LocationUID, location, nil)
+	}
+
+	ownershipsDTO := DTO("ownershipsPurged", len(ownerships))
+	locationsDTO := DTO("locationsPurged", len(locations))
+	return Success(c, "Trash was emptied", ownershipsDTO, locationsDTO)
+}
+
+/*
+* Permanently deletes every ownership and location that has been in the trash longer than the retention period.
+* Called periodically by the tasks package.
+ */
+func PurgeTrash() {
+	cutoff := time.Now().Add(-trashRetention())
+
+	var ownerships []models.Ownership
+	db.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at <= ?", cutoff).Find(&ownerships)
+	for _, ownership := range ownerships {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			return purgeOwnership(tx, ownership)
+		})
+		if err != nil {
+			log.Printf("controller#PurgeTrash: Error purging ownership %d: %v", ownership.OwnershipUID, err)
+			continue
+		}
+		appendAudit(ownership.ItemHousehold, 0, "ownership.purge", "ownership", ownership.OwnershipUID, ownership, nil)
+	}
+
+	var locations []models.Location
+	db.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at <= ?", cutoff).Find(&locations)
+	for _, location := range locations {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			return purgeLocation(tx, location)
+		})
+		if err != nil {
+			log.Printf("controller#PurgeTrash: Error purging location %d: %v", location.LocationUID, err)
+			continue
+		}
+		appendAudit(location.LocationHousehold, 0, "location.purge", "location", location.LocationUID, location, nil)
+	}
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/db/dbtest"
+	"WIG-Server/models"
+	"fmt"
+	"testing"
+)
+
+func TestTrashRestoreLocationRespectsMaxDepth(t *testing.T) {
+	dbtest.Open(t)
+
+	owner, household := testUser(t, "owner")
+	var membership models.Membership
+	db.DB.Where("household = ? AND member_user = ?", household.HouseholdUID, owner.UserUID).First(&membership)
+
+	// A box on a shelf in the garage is trashed, and the maximum depth is lowered before it is restored
+	var parent *uint
+	var chain []models.Location
+	for _, name := range []string{"Garage", "Shelf", "Box"} {
+		location := models.Location{LocationName: name, LocationOwner: owner.UserUID, LocationHousehold: household.HouseholdUID, Parent: parent}
+		db.DB.Create(&location)
+		insertLocationClosure(db.DB, location)
+		chain = append(chain, location)
+		parent = &chain[len(chain)-1].LocationUID
+	}
+	box := chain[2]
+	db.DB.Delete(&box)
+	t.Setenv("MAX_LOCATION_DEPTH", "2")
+
+	code, response := testRequest(t, TrashRestore, owner, membership, "PUT", fmt.Sprintf("/trash/restore?locationUID=%d", box.LocationUID), "")
+	if code != 200 {
+		t.Fatalf("Restoring the box returned %d: %v", code, response["message"])
+	}
+	db.DB.First(&box, box.LocationUID)
+	if box.Parent == nil || *box.Parent != 1 {
+		t.Errorf("box was not restored into the default location")
+	}
+}
@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// The purpose of an action token returned by UserLogin while the second factor is pending.
+const purposeLoginChallenge = "login_challenge"
+
+// The number of wrong codes accepted for a single login challenge before it is invalidated.
+const maxChallengeAttempts = 5
+
+// The number of recovery codes generated for a user.
+const recoveryCodeCount = 10
+
+// The name shown for WIG accounts in authenticator apps.
+const totpIssuer = "WIG"
+
+/*
+* Issues a short-lived challenge that has to be completed with UserLogin2FA before a session is created.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param user The user that passed the first factor.
+*
+* @return error The error message, if there is any.
+ */
+func loginChallenge(c *fiber.Ctx, user models.User) error {
+	challenge, err := issueActionToken(user, purposeLoginChallenge, utils.EnvDuration("LOGIN_CHALLENGE_LIFETIME", 5*time.Minute))
+	if err != nil {
+		return Error(c, 500, "There was an error generating the login challenge")
+	}
+
+	requiredDTO := DTO("twoFactorRequired", true)
+	challengeDTO := DTO("challenge", challenge)
+	return Success(c, "Two-factor code required", requiredDTO, challengeDTO)
+}
+
+/*
+* Generates a new set of recovery codes for a user, replacing any existing codes.
+*
+* @param tx The database connection or transaction to store the codes with.
+* @param user The user to generate codes for.
+*
+* @return []string The recovery codes to show to the user once.
+* @return error The error message, if there is one.
+ */
+func generateRecoveryCodes(tx *gorm.DB, user models.User) ([]string, error) {
+	if err := tx.Where("code_user = ?", user.UserUID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(secret[:5] + "-" + secret[5:10])
+
+		recovery := models.RecoveryCode{CodeUser: user.UserUID, CodeHash: utils.HashToken(code)}
+		if err := tx.Create(&recovery).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+/*
+* Checks a TOTP code or recovery code for a user with two-factor authentication.
+* Accepted codes are recorded so they cannot be used again.
+*
+* @param user The user the code was entered for.
+* @param code The TOTP code, if one was entered.
+* @param recoveryCode The recovery code, if one was entered.
+*
+* @return bool Whether the code was accepted.
+ */
+func verifySecondFactor(user models.User, code string, recoveryCode string) bool {
+	if code != "" {
+		counter, ok := utils.ValidateTOTP(user.TOTPSecret, code, user.TOTPLastCounter)
+		if !ok {
+			return false
+		}
+		result := db.DB.Model(&models.User{}).
+			Where("user_uid = ? AND totp_last_counter < ?", user.UserUID, counter).
+			Update("totp_last_counter", counter)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	if recoveryCode != "" {
+		now := time.Now()
+		hash := utils.HashToken(strings.ToLower(strings.TrimSpace(recoveryCode)))
+		result := db.DB.Model(&models.RecoveryCode{}).
+			Where("code_user = ? AND code_hash = ? AND used_at IS NULL", user.UserUID, hash).
+			Update("used_at", &now)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+/*
+* Completes a login for a user with two-factor authentication, using the challenge returned by UserLogin.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserLogin2FA(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["challenge"] == "" {
+		return Error(c, 400, "Challenge is empty and required")
+	}
+	if data["code"] == "" && data["recoveryCode"] == "" {
+		return Error(c, 400, "Code or recovery code is empty and required")
+	}
+
+	// Validate the challenge without using it up, so a mistyped code can be retried
+	claims, err := utils.ParseActionToken(data["challenge"], purposeLoginChallenge)
+	if err != nil {
+		return actionTokenError(c, err)
+	}
+	var challenge models.ActionToken
+	result := db.DB.Where("token_id = ? AND token_purpose = ? AND used_at IS NULL", claims.Id, purposeLoginChallenge).First(&challenge)
+	if result.Error != nil {
+		return actionTokenError(c, errActionTokenUsed)
+	}
+
+	var user models.User
+	result = db.DB.Where("user_uid = ?", challenge.TokenUser).First(&user)
+	code, err := RecordExists("User", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if !user.TOTPEnabled {
+		return Error(c, 400, "Two-factor authentication is not enabled")
+	}
+
+	// A challenge cannot be used while the username or IP address is locked
+	if remaining := lockoutRemaining(userThrottleKey(user.Username), ipThrottleKey(c)); remaining > 0 {
+		return lockoutError(c, remaining)
+	}
+
+	if !verifySecondFactor(user, data["code"], data["recoveryCode"]) {
+		challenge.Attempts++
+		updates := map[string]interface{}{"attempts": challenge.Attempts}
+		if challenge.Attempts >= maxChallengeAttempts {
+			updates["used_at"] = time.Now()
+		}
+		db.DB.Model(&challenge).Updates(updates)
+		recordLoginFailure(c, user.Username)
+		return Error(c, 401, "The two-factor code is invalid", DTO("reason", "code_invalid"))
+	}
+
+	if _, err := consumeActionToken(data["challenge"], purposeLoginChallenge); err != nil {
+		return actionTokenError(c, err)
+	}
+
+	return completeLogin(c, user, data["deviceName"])
+}
+
+/*
+* Starts two-factor enrollment by generating a new secret for the user.
+* Two-factor authentication is not enabled until the secret is confirmed with UserTwoFactorConfirm.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserTwoFactorEnroll(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	if user.TOTPEnabled {
+		return Error(c, 400, "Two-factor authentication is already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return Error(c, 500, "There was an error generating the secret")
+	}
+
+	db.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_counter": 0})
+
+	secretDTO := DTO("secret", secret)
+	uriDTO := DTO("uri", utils.TOTPURI(totpIssuer, user.Username, secret))
+	return Success(c, "Two-factor secret generated", secretDTO, uriDTO)
+}
+
+/*
+* Enables two-factor authentication once the user has entered a code from their authenticator app.
+* Returns the recovery codes, which are only shown this once.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserTwoFactorConfirm(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	if user.TOTPEnabled {
+		return Error(c, 400, "Two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return Error(c, 400, "Two-factor enrollment has not been started")
+	}
+	if data["code"] == "" {
+		return Error(c, 400, "Code is empty and required")
+	}
+
+	counter, ok := utils.ValidateTOTP(user.TOTPSecret, data["code"], 0)
+	if !ok {
+		return Error(c, 401, "The two-factor code is invalid", DTO("reason", "code_invalid"))
+	}
+
+	var codes []string
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_counter": counter}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = generateRecoveryCodes(tx, user)
+		return err
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error enabling two-factor authentication")
+	}
+
+	codesDTO := DTO("recoveryCodes", codes)
+	return Success(c, "Two-factor authentication enabled", codesDTO)
+}
+
+/*
+* Replaces the users recovery codes, requiring a current TOTP code or recovery code.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserTwoFactorRecoveryCodes(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	if !user.TOTPEnabled {
+		return Error(c, 400, "Two-factor authentication is not enabled")
+	}
+	if !verifySecondFactor(user, data["code"], data["recoveryCode"]) {
+		return Error(c, 401, "The two-factor code is invalid", DTO("reason", "code_invalid"))
+	}
+
+	codes, err := generateRecoveryCodes(db.DB, user)
+	if err != nil {
+		return Error(c, 500, "There was an error generating recovery codes")
+	}
+
+	codesDTO := DTO("recoveryCodes", codes)
+	return Success(c, "Recovery codes generated", codesDTO)
+}
+
+/*
+* Disables two-factor authentication, requiring a current TOTP code or recovery code.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserTwoFactorDisable(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	if !user.TOTPEnabled {
+		return Error(c, 400, "Two-factor authentication is not enabled")
+	}
+	if !verifySecondFactor(user, data["code"], data["recoveryCode"]) {
+		return Error(c, 401, "The two-factor code is invalid", DTO("reason", "code_invalid"))
+	}
+
+	db.DB.Model(&user).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_counter": 0})
+	db.DB.Where("code_user = ?", user.UserUID).Delete(&models.RecoveryCode{})
+
+	return Success(c, "Two-factor authentication disabled")
+}
@@ -4,11 +4,14 @@ import (
 	"WIG-Server/db"
 	"WIG-Server/models"
 	"WIG-Server/utils"
+	"log"
 	"net"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // The regex expression to check username requirements
@@ -31,11 +34,17 @@ func UserSalt(c *fiber.Ctx) error {
 		return Error(c, 400, "Username is empty and required")
 	}
 
-	// Query database for username
+	if remaining := lockoutRemaining(ipThrottleKey(c)); remaining > 0 {
+		return lockoutError(c, remaining)
+	}
+
+	// Query database for username, unknown usernames get a fake salt so they cannot be told apart
 	var user models.User
 	result := db.DB.Where("username = ?", username).First(&user)
 	code, err := RecordExists("Username", result)
-	if err != nil {
+	if code == 404 {
+		user.Salt = fakeSalt(username)
+	} else if err != nil {
 		return Error(c, code, err.Error())
 	}
 
@@ -75,31 +84,158 @@ func UserLogin(c *fiber.Ctx) error {
 		return Error(c, 400, "Username or hash is empty and required")
 	}
 
-	// Check that user exists
+	// Check that neither the username nor the IP address is locked
+	if remaining := lockoutRemaining(userThrottleKey(data["username"]), ipThrottleKey(c)); remaining > 0 {
+		return lockoutError(c, remaining)
+	}
+
+	// Check that user exists, answering the same way as a wrong password if it does not
 	var user models.User
 	result := db.DB.Where("username = ?", data["username"]).First(&user)
 	code, err := RecordExists("Username", result)
-	if err != nil {
+	if code == 404 {
+		verifyDummyPassword(data["hash"])
+		recordLoginFailure(c, data["username"])
+		return Error(c, 400, "The username and passwords do not match")
+	} else if err != nil {
 		return Error(c, code, err.Error())
 	}
 
 	// Check if hash matches then generate token
-	if data["hash"] != user.Hash {
+	match, rehash, err := utils.VerifyPassword(data["hash"], user.Hash)
+	if err != nil {
+		return Error(c, 500, "There was an error verifying the password")
+	}
+	if !match {
+		recordLoginFailure(c, user.Username)
 		return Error(c, 400, "The username and passwords do not match")
 	}
 
-	user.Token = utils.GenerateToken(user.Username, user.Hash)
+	if user.Disabled {
+		return accountDisabledError(c)
+	}
+
+	// Upgrade legacy or outdated hashes now that the credential is known
+	if rehash {
+		if hash, err := utils.HashPassword(data["hash"]); err == nil {
+			db.DB.Model(&user).Update("hash", hash)
+		}
+	}
 
-	if user.Token == "error" {
-		return Error(c, 400, "There was an error generating user token")
+	// Users with two-factor authentication receive a challenge instead of a token
+	if user.TOTPEnabled {
+		return loginChallenge(c, user)
 	}
 
-	tokenDTO := DTO("token", user.Token)
+	return completeLogin(c, user, data["deviceName"])
+}
+
+/*
+* Exchanges a refresh token for a new access token and a new refresh token.
+* Each refresh token can only be used once, presenting a used token revokes its whole session.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+*/
+func UserRefresh(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["refreshToken"] == "" {
+		return Error(c, 400, "Refresh token is empty and required")
+	}
+
+	// Check that the refresh token exists
+	var refresh models.RefreshToken
+	result := db.DB.Where("token_hash = ?", utils.HashToken(data["refreshToken"])).First(&refresh)
+	if result.Error != nil {
+		return Error(c, 401, "Refresh token is invalid", DTO("reason", "refresh_invalid"))
+	}
+
+	// A token that was already exchanged or revoked is being replayed
+	if refresh.UsedAt != nil || refresh.RevokedAt != nil {
+		revokeSession(refresh.TokenSession)
+		log.Printf("controller#UserRefresh: Refresh token reuse detected for user %d, session %d revoked", refresh.TokenUser, refresh.TokenSession)
+		return Error(c, 401, "Refresh token has already been used", DTO("reason", "refresh_reused"))
+	}
+	if time.Now().After(refresh.ExpiresAt) {
+		return Error(c, 401, "Refresh token has expired", DTO("reason", "refresh_expired"))
+	}
+
+	var session models.Session
+	result = db.DB.Where("session_uid = ? AND revoked_at IS NULL", refresh.TokenSession).First(&session)
+	if result.Error != nil {
+		return Error(c, 401, "Session has been revoked", DTO("reason", "session_revoked"))
+	}
+
+	var user models.User
+	result = db.DB.Where("user_uid = ?", refresh.TokenUser).First(&user)
+	code, err := RecordExists("User", result)
+	if err != nil {
+		return Error(c, code, err.Error())
+	}
+	if user.Disabled {
+		return accountDisabledError(c)
+	}
+
+	// Rotate the refresh token and issue a new access token
+	var token, refreshToken string
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("refresh_token_uid = ? AND used_at IS NULL", refresh.RefreshTokenUID).
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshReused
+		}
+
+		refreshToken, err = issueRefreshToken(tx, session)
+		if err != nil {
+			return err
+		}
+
+		token, err = utils.GenerateToken(user.UserUID, session.SessionUID, user.Username)
+		return err
+	})
+	if err == errRefreshReused {
+		revokeSession(session.SessionUID)
+		return Error(c, 401, "Refresh token has already been used", DTO("reason", "refresh_reused"))
+	}
+	if err != nil {
+		return Error(c, 500, "There was an error refreshing the user token")
+	}
+
+	tokenDTO := DTO("token", token)
+	refreshDTO := DTO("refreshToken", refreshToken)
 	uidDTO := DTO("uid", user.UserUID)
 
-	db.DB.Save(&user)
+	return Success(c, "Token was refreshed", tokenDTO, refreshDTO, uidDTO)
+}
 
-	return Success(c, "Login was successful", tokenDTO, uidDTO)
+/*
+* Creates a new user record, used by every signup path so new accounts are set up the same way.
+* Every user starts with a personal household.
+*
+* @param tx The transaction to create the user with.
+* @param user The user to create.
+*
+* @return error The error message, if there is one.
+*/
+func createUser(tx *gorm.DB, user *models.User) error {
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+	_, err := createHousehold(tx, *user, user.Username+"'s household")
+	return err
 }
 
 /* 
@@ -156,17 +292,31 @@ func UserSignup(c *fiber.Ctx) error {
 		return Error(c, 400, "Email domain does not exist")
 	}
 
+	// Hash the clients credential again before it is stored
+	hash, err := utils.HashPassword(data["hash"])
+	if err != nil {
+		return Error(c, 500, "There was an error hashing the password")
+	}
+
 	// Set user model
 	user = models.User{
 		Username: data["username"],
 		Email:    data["email"],
 		Salt:     data["salt"],
-		Hash:     data["hash"],
+		Hash:     hash,
 	}
 
-	db.DB.Create(&user)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		return createUser(tx, &user)
+	})
+	if err != nil {
+		return Error(c, 500, "There was an error creating the user")
+	}
 
-	// TODO send verification email
+	// The account is usable without verification, so a failed email is only logged
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("controller#UserSignup: Error sending verification email: %v", err)
+	}
 
 	return Success(c, "Signup was successful")
 }
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/db/dbtest"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"testing"
+)
+
+func TestLoginThrottleSurvivesPasswordUntilSecondFactor(t *testing.T) {
+	dbtest.Open(t)
+	t.Setenv("TOKEN_SECRET", "test-token-secret")
+
+	hash, err := utils.HashPassword("correct")
+	if err != nil {
+		t.Fatalf("Hashing the password failed: %v", err)
+	}
+	user := models.User{Username: "alice", Email: "alice@example.com", Hash: hash, TOTPEnabled: true, TOTPSecret: "JBSWY3DPEHPK3PXP"}
+	db.DB.Create(&user)
+
+	login := func(password string) (int, map[string]interface{}) {
+		return testRequest(t, UserLogin, models.User{}, models.Membership{}, "POST", "/user/login", `{"username":"alice","hash":"`+password+`"}`)
+	}
+	failures := func() int {
+		var throttle models.LoginThrottle
+		db.DB.Where("throttle_key = ?", userThrottleKey("alice")).First(&throttle)
+		return throttle.Failures
+	}
+
+	// The password alone does not forgive earlier failures
+	login("wrong")
+	login("wrong")
+	code, response := login("correct")
+	if code != 200 || response["challenge"] == nil {
+		t.Fatalf("Login with the password returned %d: %v", code, response["message"])
+	}
+	if failures() != 2 {
+		t.Errorf("password login left %d failures, want 2", failures())
+	}
+
+	// Once the username is locked the challenge cannot be used either
+	for failures() < defaultMaxUserAttempts {
+		login("wrong")
+	}
+	code, response = testRequest(t, UserLogin2FA, models.User{}, models.Membership{}, "POST", "/user/login/2fa", `{"challenge":"`+response["challenge"].(string)+`","code":"000000"}`)
+	if code != 429 {
+		t.Errorf("second factor on a locked username returned %d: %v", code, response["message"])
+	}
+}
@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/mailer"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/joho/godotenv"
+)
+
+// The purpose of an action token that confirms a users email address.
+const purposeVerifyEmail = "verify_email"
+
+// Returned by consumeActionToken when the token was already used or replaced by a newer one.
+var errActionTokenUsed = errors.New("token has already been used")
+
+/*
+* Builds a link that opens the WIG-Application with an action token.
+* APP_LINK_URL sets the base of the link, e.g. a custom scheme or a universal link.
+*
+* @param path The path the application handles, e.g. "verify".
+* @param token The action token.
+*
+* @return string The link to include in an email.
+ */
+func appLink(path string, token string) string {
+	godotenv.Load()
+	base := os.Getenv("APP_LINK_URL")
+	if base == "" {
+		base = "wig://"
+	}
+	return base + path + "?token=" + token
+}
+
+/*
+* Creates and stores a new action token for a user.
+* Any unused tokens with the same purpose are invalidated so only the newest one works.
+*
+* @param user The user the token is for.
+* @param purpose The action the token may be used for.
+* @param lifetime How long the token stays valid.
+*
+* @return string The signed action token.
+* @return error The error message, if there is one.
+ */
+func issueActionToken(user models.User, purpose string, lifetime time.Duration) (string, error) {
+	tokenID, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	db.DB.Model(&models.ActionToken{}).
+		Where("token_user = ? AND token_purpose = ? AND used_at IS NULL", user.UserUID, purpose).
+		Update("used_at", &now)
+
+	actionToken := models.ActionToken{
+		TokenUser:    user.UserUID,
+		TokenPurpose: purpose,
+		TokenID:      tokenID,
+		ExpiresAt:    now.Add(lifetime),
+	}
+	if err := db.DB.Create(&actionToken).Error; err != nil {
+		return "", err
+	}
+
+	return utils.GenerateActionToken(user.UserUID, purpose, tokenID, lifetime)
+}
+
+/*
+* Verifies an action token and marks it as used.
+*
+* @param token The signed action token.
+* @param purpose The action the token is being used for.
+*
+* @return models.User The user the token was issued to.
+* @return error utils.ErrTokenExpired, utils.ErrTokenInvalid or errActionTokenUsed, if the token cannot be used.
+ */
+func consumeActionToken(token string, purpose string) (models.User, error) {
+	var user models.User
+
+	claims, err := utils.ParseActionToken(token, purpose)
+	if err != nil {
+		return user, err
+	}
+	uid, err := claims.UserUID()
+	if err != nil {
+		return user, err
+	}
+
+	now := time.Now()
+	result := db.DB.Model(&models.ActionToken{}).
+		Where("token_id = ? AND token_user = ? AND token_purpose = ? AND used_at IS NULL", claims.Id, uid, purpose).
+		Update("used_at", &now)
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, errActionTokenUsed
+	}
+
+	if err := db.DB.Where("user_uid = ?", uid).First(&user).Error; err != nil {
+		return user, utils.ErrTokenInvalid
+	}
+	return user, nil
+}
+
+/*
+* Returns an error response for an action token that could not be consumed.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param err The error returned by consumeActionToken.
+*
+* @return error The c.Status being returned via fiber.
+ */
+func actionTokenError(c *fiber.Ctx, err error) error {
+	switch err {
+	case utils.ErrTokenExpired:
+		return Error(c, 400, "Token has expired", DTO("reason", "token_expired"))
+	case errActionTokenUsed:
+		return Error(c, 400, "Token has already been used", DTO("reason", "token_used"))
+	case utils.ErrTokenInvalid:
+		return Error(c, 400, "Token is invalid", DTO("reason", "token_invalid"))
+	}
+	return Error(c, 500, "There was an error checking the token")
+}
+
+/*
+* Sends the user an email containing a link to confirm their email address.
+*
+* @param user The user to send the email to.
+*
+* @return error The error message, if there is one.
+ */
+func sendVerificationEmail(user models.User) error {
+	token, err := issueActionToken(user, purposeVerifyEmail, utils.EnvDuration("EMAIL_VERIFICATION_LIFETIME", 48*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	body := "Hi " + user.Username + ",\n\n" +
+		"Please confirm your email address for WIG by opening the link below:\n\n" +
+		appLink("verify", token) + "\n\n" +
+		"If you did not create a WIG account you can ignore this email."
+
+	return mailer.Send(user.Email, "Confirm your WIG email address", body)
+}
+
+/*
+* Confirms a users email address with the token sent in the verification email.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserVerify(c *fiber.Ctx) error {
+	// Parse request into data map
+	var data map[string]string
+	err := c.BodyParser(&data)
+	if err != nil {
+		return Error(c, 400, "There was an error parsing JSON")
+	}
+
+	// Check for empty fields
+	if data["token"] == "" {
+		return Error(c, 400, "Token is empty and required")
+	}
+
+	user, err := consumeActionToken(data["token"], purposeVerifyEmail)
+	if err != nil {
+		return actionTokenError(c, err)
+	}
+
+	db.DB.Model(&user).Update("email_confirm", "true")
+
+	return Success(c, "Email was successfully verified")
+}
+
+/*
+* Sends a new verification email to the user, at most once per EMAIL_RESEND_INTERVAL.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+*
+* @return error The error message, if there is any.
+ */
+func UserVerifyResend(c *fiber.Ctx) error {
+	// Initialize variables
+	user := c.Locals("user").(models.User)
+
+	if user.EmailConfirm == "true" {
+		return Error(c, 400, "Email is already verified")
+	}
+
+	// Throttle resends based on the most recent verification token
+	interval := utils.EnvDuration("EMAIL_RESEND_INTERVAL", time.Minute)
+	var last models.ActionToken
+	result := db.DB.Where("token_user = ? AND token_purpose = ?", user.UserUID, purposeVerifyEmail).Order("created_at DESC").First(&last)
+	if result.Error == nil && time.Since(last.CreatedAt) < interval {
+		retryAfter := int(math.Ceil((interval - time.Since(last.CreatedAt)).Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return Error(c, 429, "A verification email was sent recently", DTO("retryAfter", retryAfter))
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("controller#UserVerifyResend: %v", err)
+		return Error(c, 500, "There was an error sending the verification email")
+	}
+
+	return Success(c, "Verification email was sent")
+}
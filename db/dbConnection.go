@@ -63,6 +63,23 @@ func AutoMigrate(connection *gorm.DB) {
 		&models.Borrower{},
 		&models.Location{},
 		&models.Ownership{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.ActionToken{},
+		&models.RecoveryCode{},
+		&models.ApiClient{},
+		&models.PersonalAccessToken{},
+		&models.LoginThrottle{},
+		&models.ExternalIdentity{},
+		&models.OIDCState{},
+		&models.UsageCounter{},
+		&models.Household{},
+		&models.Membership{},
+		&models.HouseholdInvitation{},
+		&models.LocationGrant{},
+		&models.AuditLog{},
+		&models.OwnershipEvent{},
+		&models.LocationClosure{},
 	)
 
 	// Check if Borrower table is empty
@@ -119,6 +136,100 @@ func AutoMigrate(connection *gorm.DB) {
 		connection.Create(&defaultItem)
 	}
 
+	// Members from before household roles become editors
+	connection.Model(&models.Membership{}).Where("member_role = ?", "member").Update("member_role", models.HouseholdEditor)
+
+	// Ownership history outlives the users who made it, so the actor is no longer a foreign key
+	if connection.Migrator().HasConstraint(&models.OwnershipEvent{}, "fk_ownership_events_user") {
+		connection.Migrator().DropConstraint(&models.OwnershipEvent{}, "fk_ownership_events_user")
+	}
+
+	// Give users from before households a personal household and move their records into it
+	var users []models.User
+	connection.Where("user_uid <> 1 AND user_uid NOT IN (?)", connection.Model(&models.Membership{}).Select("member_user")).Find(&users)
+
+	for _, user := range users {
+		household := models.Household{
+			HouseholdName:  user.Username + "'s household",
+			HouseholdOwner: user.UserUID}
+		connection.Create(&household)
+		connection.Create(&models.Membership{
+			Household:  household.HouseholdUID,
+			MemberUser: user.UserUID,
+			MemberRole: models.HouseholdOwner,
+			JoinedAt:   time.Now()})
+
+		connection.Model(&models.Ownership{}).Where("item_owner = ? AND item_household = 0", user.UserUID).
+			Update("item_household", household.HouseholdUID)
+		connection.Model(&models.Location{}).Where("location_owner = ? AND location_household = 0 AND location_uid <> 1", user.UserUID).
+			Update("location_household", household.HouseholdUID)
+		connection.Model(&models.Borrower{}).Where("borrower_owner = ? AND borrower_household = 0 AND borrower_uid > 2", user.UserUID).
+			Update("borrower_household", household.HouseholdUID)
+	}
+
+	// Build the location closure table for locations from before it existed
+	var closureCount int64
+	connection.Model(&models.LocationClosure{}).Count(&closureCount)
+
+	if closureCount == 0 {
+		if err := RebuildLocationClosures(connection); err != nil {
+			fmt.Println("Building the location closure table failed:", err)
+		}
+	}
+
+}
+
+/*
+* Rebuilds the location closure table from the parent of every location.
+* Loops in the parents are cut off where they return to a location already on the chain.
+*
+* @param connection The database connection instance to rebuild the table on.
+*
+* @return error The error message, if there is one.
+ */
+func RebuildLocationClosures(connection *gorm.DB) error {
+	var locations []models.Location
+	connection.Select("location_uid", "location_parent", "location_household").Where("location_uid <> 1").Find(&locations)
+
+	// Locations without a parent are kept with a parent of 0, so every location is known
+	parents := map[uint]uint{}
+	for _, location := range locations {
+		parents[location.LocationUID] = 0
+		if location.Parent != nil {
+			parents[location.LocationUID] = *location.Parent
+		}
+	}
+
+	closures := []models.LocationClosure{}
+	for _, location := range locations {
+		ancestor := location.LocationUID
+		seen := map[uint]bool{}
+		for depth := 0; !seen[ancestor]; depth++ {
+			seen[ancestor] = true
+			closures = append(closures, models.LocationClosure{
+				Ancestor:         ancestor,
+				Descendant:       location.LocationUID,
+				Depth:            depth,
+				ClosureHousehold: location.LocationHousehold})
+
+			// The chain ends at the default location or a location that does not exist
+			parent := parents[ancestor]
+			if _, exists := parents[parent]; !exists {
+				break
+			}
+			ancestor = parent
+		}
+	}
+
+	return connection.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.LocationClosure{}).Error; err != nil {
+			return err
+		}
+		if len(closures) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(closures, 500).Error
+	})
 }
 
 /*
@@ -0,0 +1,42 @@
+// Provides an in-memory database for the tests of the WIG-Server application.
+package dbtest
+
+import (
+	"WIG-Server/db"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+* Opens a new in-memory database with foreign keys enforced, migrates it and makes it the db.DB connection.
+* The database is closed when the test finishes.
+*
+* @param t The test using the database.
+*
+* @return *gorm.DB The database connection instance.
+ */
+func Open(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	connection, err := gorm.Open(sqlite.Open("file::memory:?_pragma=foreign_keys(1)"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("dbtest#Open: Opening the database failed: %v", err)
+	}
+
+	// Every connection to :memory: is a separate database, so only one is kept open
+	sqlDB, err := connection.DB()
+	if err != nil {
+		t.Fatalf("dbtest#Open: Getting the connection pool failed: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db.AutoMigrate(connection)
+	db.DB = connection
+	return connection
+}
@@ -0,0 +1,133 @@
+// Sends emails from the WIG-Server application.
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Mailer delivers a plain text email to a single recipient.
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// The mailer used by Send, configured with Use.
+var active Mailer
+
+// SMTPMailer delivers emails through an SMTP server.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// LogMailer writes emails to the log instead of delivering them, used when SMTP is not configured.
+type LogMailer struct{}
+
+/*
+* Creates a mailer from the SMTP settings in the .env file.
+* A LogMailer is returned when SMTP_HOST is not set.
+*
+* @return Mailer The configured mailer.
+ */
+func FromEnv() Mailer {
+	godotenv.Load()
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogMailer{}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+
+	return SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+/*
+* Sets the mailer used by Send.
+*
+* @param mailer The mailer to use.
+ */
+func Use(mailer Mailer) {
+	active = mailer
+}
+
+/*
+* Sends an email with the active mailer.
+*
+* @param to The recipients email address.
+* @param subject The subject line.
+* @param body The plain text body.
+*
+* @return error The error message, if there is one.
+ */
+func Send(to string, subject string, body string) error {
+	if active == nil {
+		return LogMailer{}.Send(to, subject, body)
+	}
+	return active.Send(to, subject, body)
+}
+
+/*
+* Sends an email through the SMTP server.
+* Authentication is only used when a username is configured, so local SMTP sinks work without credentials.
+*
+* @param to The recipients email address.
+* @param subject The subject line.
+* @param body The plain text body.
+*
+* @return error The error message, if there is one.
+ */
+func (m SMTPMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	headers := []string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+
+	err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(message))
+	if err != nil {
+		return fmt.Errorf("mailer#Send: %w", err)
+	}
+	log.Printf("mailer#Send: Email %q sent to %s", subject, to)
+	return nil
+}
+
+/*
+* Logs the email instead of sending it.
+*
+* @param to The recipients email address.
+* @param subject The subject line.
+* @param body The plain text body.
+*
+* @return error Always nil.
+ */
+func (LogMailer) Send(to string, subject string, body string) error {
+	log.Printf("mailer#Send: SMTP is not configured, email to %s\nSubject: %s\n\n%s", to, subject, body)
+	return nil
+}
@@ -2,22 +2,29 @@
 package main
 
 import (
+	"WIG-Server/cli"
 	"WIG-Server/routes"
 	"WIG-Server/db"
-	"github.com/gofiber/fiber/v2"
-	"WIG-Server/middleware"
+	"WIG-Server/mailer"
+	"WIG-Server/tasks"
+	"os"
 )
 
 /*
-* Connects to the database, sets up routes, and starts the backend server.
+* Connects to the database and runs a management command if one was given.
+* Otherwise configures the mailer, starts background tasks, sets up routes, and starts the backend server.
 */
 func main() {
 	db.Connect()
-	app := fiber.New()
-	app.Use(middleware.AppAuth())
-	loggedRoutes := app.Group("/app")
-	loggedRoutes.Use(middleware.ValidateToken())
-	routes.Setup(app)
+
+	// Run a management command instead of the server when arguments are given
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
+	mailer.Use(mailer.FromEnv())
+	tasks.Start()
+	app := routes.App()
 	app.Listen(":" + db.GetPort()) 
 }
 
@@ -5,48 +5,252 @@ import (
 	"WIG-Server/controller"
 	"WIG-Server/db"
 	"WIG-Server/models"
-	"fmt"
+	"WIG-Server/utils"
+	"crypto/subtle"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
+// How often the last seen time of a session is written to the database.
+const lastSeenInterval = time.Minute
+
 /*
-* Checks that the AppAuth header is valid.
+* Checks that the AppAuth header holds the key of a registered API client.
+* The client must have a scope for the first segment of the path, e.g. "user" or "app".
+* The legacy APP_SECRET is still accepted while ALLOW_LEGACY_APP_SECRET is true.
  */
 func AppAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		godotenv.Load()
 		headerValue := c.Get("AppAuth")
 
-		if headerValue != os.Getenv("APP_SECRET") {
-			return controller.Error(c, 400, "Unauthorized")
+		if headerValue == "" {
+			return controller.Error(c, fiber.StatusUnauthorized, "Unauthorized", controller.DTO("reason", "app_auth_missing"))
+		}
+
+		secret := os.Getenv("APP_SECRET")
+		if os.Getenv("ALLOW_LEGACY_APP_SECRET") == "true" && secret != "" &&
+			subtle.ConstantTimeCompare([]byte(headerValue), []byte(secret)) == 1 {
+			return c.Next()
+		}
+
+		var client models.ApiClient
+		result := db.DB.Where("key_hash = ? AND revoked_at IS NULL", utils.HashToken(headerValue)).First(&client)
+		if result.Error != nil {
+			return controller.Error(c, fiber.StatusUnauthorized, "Unauthorized", controller.DTO("reason", "app_auth_invalid"))
 		}
+
+		scope := strings.SplitN(strings.TrimPrefix(c.Path(), "/"), "/", 2)[0]
+		if !utils.ScopeAllows(client.Scopes, scope) {
+			return controller.Error(c, fiber.StatusForbidden, "Client is not allowed to access this route", controller.DTO("reason", "app_scope"))
+		}
+
+		db.DB.Model(&client).UpdateColumns(map[string]interface{}{
+			"usage_count":  gorm.Expr("usage_count + 1"),
+			"last_used_at": time.Now(),
+		})
+
+		c.Locals("client", client)
 		return c.Next()
 	}
 }
 
 /*
 * Checks that the users token is still valid.
+* The token signature and expiry are verified before its session is resolved,
+* and failures return a 401 with a machine-readable reason.
  */
 func ValidateToken() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		token := c.Get("Authorization")
-		fmt.Println("WORKING")
+		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
 
 		if token == "" {
-			return controller.Error(c, fiber.StatusBadRequest, "Token missing")
+			return controller.Error(c, fiber.StatusUnauthorized, "Token missing", controller.DTO("reason", "token_missing"))
+		}
+
+		if strings.HasPrefix(token, controller.AccessTokenPrefix) {
+			return validateAccessToken(c, token)
+		}
+
+		claims, err := utils.ParseToken(token)
+		if err == utils.ErrTokenExpired {
+			return controller.Error(c, fiber.StatusUnauthorized, "Token has expired", controller.DTO("reason", "token_expired"))
+		}
+		if err != nil {
+			return controller.Error(c, fiber.StatusUnauthorized, "Token is invalid", controller.DTO("reason", "token_invalid"))
+		}
+
+		uid, err := claims.UserUID()
+		if err != nil {
+			return controller.Error(c, fiber.StatusUnauthorized, "Token is invalid", controller.DTO("reason", "token_invalid"))
+		}
+
+		// The session the token was issued for must still be active
+		var session models.Session
+		result := db.DB.Where("session_uid = ? AND session_user = ? AND revoked_at IS NULL", claims.SessionUID, uid).First(&session)
+
+		if result.Error != nil {
+			return controller.Error(c, fiber.StatusUnauthorized, "Session has been revoked", controller.DTO("reason", "session_revoked"))
 		}
 
 		var user models.User
-		result := db.DB.Where("token = ?", token).First(&user)
+		result = db.DB.Where("user_uid = ?", uid).First(&user)
 
 		if result.Error != nil {
-			return controller.Error(c, fiber.StatusUnauthorized, "Unauthorized")
+			return controller.Error(c, fiber.StatusUnauthorized, "Unauthorized", controller.DTO("reason", "token_invalid"))
+		}
+		if user.Disabled {
+			return controller.Error(c, fiber.StatusForbidden, "Account has been disabled", controller.DTO("reason", "account_disabled"))
+		}
+
+		// Only record activity once per interval to avoid a write on every request
+		if time.Since(session.LastSeen) > lastSeenInterval {
+			session.LastSeen = time.Now()
+			session.IPAddress = c.IP()
+			db.DB.Model(&session).Updates(map[string]interface{}{"last_seen": session.LastSeen, "ip_address": session.IPAddress})
 		}
 
+		// Session tokens are not limited by scopes
+		c.Locals("session", session)
+		c.Locals("scopes", "*")
 		c.Locals("user", user)
 		return c.Next()
 	}
 }
+
+/*
+* Resolves the user of a personal access token and limits the request to the tokens scopes.
+*
+* @param c The Fiber context containing the HTTP request and response objects.
+* @param token The personal access token.
+*
+* @return error The error message, if there is any.
+ */
+func validateAccessToken(c *fiber.Ctx, token string) error {
+	var accessToken models.PersonalAccessToken
+	result := db.DB.Where("pat_hash = ? AND revoked_at IS NULL", utils.HashToken(token)).First(&accessToken)
+
+	if result.Error != nil {
+		return controller.Error(c, fiber.StatusUnauthorized, "Token is invalid", controller.DTO("reason", "token_invalid"))
+	}
+	if accessToken.ExpiresAt != nil && time.Now().After(*accessToken.ExpiresAt) {
+		return controller.Error(c, fiber.StatusUnauthorized, "Token has expired", controller.DTO("reason", "token_expired"))
+	}
+
+	var user models.User
+	result = db.DB.Where("user_uid = ?", accessToken.TokenUser).First(&user)
+
+	if result.Error != nil {
+		return controller.Error(c, fiber.StatusUnauthorized, "Unauthorized", controller.DTO("reason", "token_invalid"))
+	}
+	if user.Disabled {
+		return controller.Error(c, fiber.StatusForbidden, "Account has been disabled", controller.DTO("reason", "account_disabled"))
+	}
+
+	// Only record activity once per interval to avoid a write on every request
+	if accessToken.LastUsedAt == nil || time.Since(*accessToken.LastUsedAt) > lastSeenInterval {
+		db.DB.Model(&accessToken).Update("last_used_at", time.Now())
+	}
+
+	c.Locals("scopes", accessToken.Scopes)
+	c.Locals("user", user)
+	return c.Next()
+}
+
+/*
+* Rejects requests whose token was not granted the required scope.
+* Must run after ValidateToken.
+*
+* @param scope The scope required for the route, e.g. "ownership:write".
+ */
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, _ := c.Locals("scopes").(string)
+		if !utils.ScopeAllows(scopes, scope) {
+			return controller.Error(c, fiber.StatusForbidden, "Token is missing the "+scope+" scope", controller.DTO("reason", "insufficient_scope"), controller.DTO("requiredScope", scope))
+		}
+		return c.Next()
+	}
+}
+
+/*
+* Rejects users that have not verified their email address.
+* Only enforced when REQUIRE_EMAIL_VERIFICATION is set to true, must run after ValidateToken.
+ */
+func RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		godotenv.Load()
+		if os.Getenv("REQUIRE_EMAIL_VERIFICATION") != "true" {
+			return c.Next()
+		}
+
+		user, ok := c.Locals("user").(models.User)
+		if !ok || user.EmailConfirm != "true" {
+			return controller.Error(c, fiber.StatusForbidden, "Email address has not been verified", controller.DTO("reason", "email_unverified"))
+		}
+		return c.Next()
+	}
+}
+
+/*
+* Rejects users that are not admins.
+* Must run after ValidateToken.
+ */
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(models.User)
+		if !ok || user.Role != models.RoleAdmin {
+			return controller.Error(c, fiber.StatusForbidden, "Admin role required", controller.DTO("reason", "admin_required"))
+		}
+		return c.Next()
+	}
+}
+
+/*
+* Resolves the household a request works in and checks the user is a member of it.
+* The household is chosen with the Household header, defaulting to the first household the user joined.
+* Users that are not members but were granted access to some of its locations get those grants instead of a membership.
+* Must run after ValidateToken.
+ */
+func ResolveHousehold() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(models.User)
+		householdUID := c.Get("Household")
+
+		var membership models.Membership
+		query := db.DB.Where("member_user = ?", user.UserUID)
+		if householdUID != "" {
+			query = query.Where("household = ?", householdUID)
+		}
+		result := query.Order("joined_at").First(&membership)
+
+		var grants []models.LocationGrant
+		if result.Error != nil && householdUID != "" {
+			db.DB.Where("grant_household = ? AND grant_user = ?", householdUID, user.UserUID).Find(&grants)
+		}
+		if result.Error != nil && len(grants) == 0 {
+			return controller.Error(c, fiber.StatusForbidden, "Not a member of this household", controller.DTO("reason", "household_forbidden"))
+		}
+
+		if len(grants) > 0 {
+			membership.Household = grants[0].GrantHousehold
+		}
+		var household models.Household
+		if db.DB.Where("household_uid = ?", membership.Household).First(&household).Error != nil {
+			return controller.Error(c, fiber.StatusForbidden, "Not a member of this household", controller.DTO("reason", "household_forbidden"))
+		}
+
+		c.Locals("household", household)
+		if len(grants) > 0 {
+			c.Locals("grants", grants)
+		} else {
+			c.Locals("membership", membership)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Represents a single-use action token, such as an email verification link.
+// The token itself is signed, only its jti is stored to track whether it has been used.
+type ActionToken struct {
+	ActionTokenUID uint       `json:"-" gorm:"primary_key;column:action_token_uid"`
+	TokenUser      uint       `json:"-" gorm:"column:token_user;index"`
+	TokenPurpose   string     `json:"-" gorm:"type:varchar(32);column:token_purpose"`
+	TokenID        string     `json:"-" gorm:"type:varchar(64);column:token_id;uniqueIndex"`
+	Attempts       int        `json:"-" gorm:"column:attempts;default:0"`
+	ExpiresAt      time.Time  `json:"-" gorm:"column:expires_at"`
+	UsedAt         *time.Time `json:"-" gorm:"column:used_at"`
+	CreatedAt      time.Time  `json:"-" gorm:"column:created_at"`
+}
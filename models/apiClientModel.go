@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Represents a registered API client, such as the mobile app, a script or an integration.
+// Only the SHA-256 hash of the clients key is stored, the prefix is kept to identify the key.
+type ApiClient struct {
+	ClientUID  uint       `json:"clientUID" gorm:"primary_key;column:client_uid"`
+	ClientName string     `json:"clientName" gorm:"column:client_name"`
+	KeyPrefix  string     `json:"keyPrefix" gorm:"type:varchar(16);column:key_prefix"`
+	KeyHash    string     `json:"-" gorm:"type:varchar(64);column:key_hash;uniqueIndex"`
+	Scopes     string     `json:"scopes" gorm:"column:scopes"`
+	UsageCount int64      `json:"usageCount" gorm:"column:usage_count;default:0"`
+	LastUsedAt *time.Time `json:"lastUsedAt" gorm:"column:last_used_at"`
+	CreatedAt  time.Time  `json:"createdAt" gorm:"column:created_at"`
+	RevokedAt  *time.Time `json:"revokedAt" gorm:"column:revoked_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Returned when something tries to change or remove an audit log entry.
+var ErrAuditLogAppendOnly = errors.New("audit log entries cannot be changed or deleted")
+
+// Represents a change made to a household, recording who made it and the fields it changed.
+// Entries are append-only.
+type AuditLog struct {
+	AuditUID       uint            `json:"auditUID" gorm:"primary_key;column:audit_uid"`
+	AuditHousehold uint            `json:"householdUID" gorm:"column:audit_household;index:idx_audit_household_entity"`
+	Actor          uint            `json:"actor" gorm:"column:actor;index"`
+	Action         string          `json:"action" gorm:"type:varchar(64);column:action"`
+	EntityType     string          `json:"entityType" gorm:"type:varchar(32);column:entity_type;index:idx_audit_household_entity"`
+	EntityID       uint            `json:"entityID" gorm:"column:entity_id;index:idx_audit_household_entity"`
+	Before         json.RawMessage `json:"before" gorm:"type:text;column:before_state"`
+	After          json.RawMessage `json:"after" gorm:"type:text;column:after_state"`
+	CreatedAt      time.Time       `json:"createdAt" gorm:"column:created_at;index"`
+}
+
+// Rejects updates to audit log entries.
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+// Rejects deletion of audit log entries.
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
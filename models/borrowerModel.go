@@ -6,4 +6,5 @@ type Borrower struct {
 	BorrowerUID  	uint    `json:"borrowerUID" gorm:"primary_key;column:borrower_uid"`
 	BorrowerName 	string  `json:"borrowerName" gorm:"column:borrower_name"`
 	BorrowerOwner	uint 	`json:"-" gorm:"column:borrower_owner"`
+	BorrowerHousehold	uint	`json:"-" gorm:"column:borrower_household;index"`
 }
@@ -10,3 +10,60 @@ type CheckedOutDTO struct {
 	Borrower Borrower `json:"borrower"`
 	Ownerships []Ownership `json:"ownerships"`
 }
+
+// Represents an item along with the number of ownerships referencing it.
+type ItemUsageDTO struct {
+	ItemUid    uint   `json:"itemUID"`
+	Barcode    string `json:"barcode"`
+	Name       string `json:"itemName"`
+	Ownerships int64  `json:"ownerships"`
+}
+
+// Represents statistics about the global item catalog.
+type ItemStatsDTO struct {
+	Items           int64          `json:"items"`
+	OwnedItems      int64          `json:"ownedItems"`
+	UnownedItems    int64          `json:"unownedItems"`
+	IncompleteItems int64          `json:"incompleteItems"`
+	Ownerships      int64          `json:"ownerships"`
+	TopItems        []ItemUsageDTO `json:"topItems"`
+}
+
+// Represents what deleting a location will do to the records inside of it.
+type LocationDeleteDTO struct {
+	Location   Location    `json:"location"`
+	Mode       string      `json:"mode"`
+	Target     *Location   `json:"target"`
+	Ownerships []Ownership `json:"ownerships"`
+	Locations  []Location  `json:"locations"`
+}
+
+// Represents a location in the location tree, along with the locations inside of it.
+type LocationTreeDTO struct {
+	LocationUID     uint              `json:"locationUID"`
+	LocationName    string            `json:"locationName"`
+	LocationQR      string            `json:"locationQR"`
+	Ownerships      int64             `json:"ownerships"`
+	TotalOwnerships int64             `json:"totalOwnerships"`
+	Children        []LocationTreeDTO `json:"children"`
+}
+
+// Represents an ownership found when unpacking a location, with the path to it from the unpacked location.
+type UnpackedOwnershipDTO struct {
+	Ownership
+	Path string `json:"path"`
+}
+
+// Represents a location found when unpacking a location, with the path to it from the unpacked location.
+type UnpackedLocationDTO struct {
+	Location
+	Path string `json:"path"`
+}
+
+// Represents the totals of everything inside of an unpacked location.
+type UnpackTotalsDTO struct {
+	Locations  int `json:"locations"`
+	Ownerships int `json:"ownerships"`
+	Quantity   int `json:"quantity"`
+	CheckedOut int `json:"checkedOut"`
+}
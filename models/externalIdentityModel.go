@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Represents an identity at an external OpenID Connect provider that is linked to a user.
+type ExternalIdentity struct {
+	IdentityUID  uint      `json:"identityUID" gorm:"primary_key;column:identity_uid"`
+	IdentityUser uint      `json:"-" gorm:"column:identity_user;index"`
+	Provider     string    `json:"provider" gorm:"type:varchar(64);column:provider"`
+	Issuer       string    `json:"issuer" gorm:"type:varchar(191);column:issuer;uniqueIndex:idx_identity_issuer_subject"`
+	Subject      string    `json:"-" gorm:"type:varchar(191);column:subject;uniqueIndex:idx_identity_issuer_subject"`
+	Email        string    `json:"email" gorm:"column:email"`
+	CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// Represents a pending OpenID Connect authorization request.
+// The state is only stored as a hash and is deleted once the callback is handled.
+type OIDCState struct {
+	StateUID     uint      `json:"-" gorm:"primary_key;column:state_uid"`
+	StateHash    string    `json:"-" gorm:"type:varchar(64);column:state_hash;uniqueIndex"`
+	Provider     string    `json:"-" gorm:"type:varchar(64);column:provider"`
+	Nonce        string    `json:"-" gorm:"column:nonce"`
+	CodeVerifier string    `json:"-" gorm:"column:code_verifier"`
+	LinkUser     uint      `json:"-" gorm:"column:link_user"`
+	ExpiresAt    time.Time `json:"-" gorm:"column:expires_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// The roles a member of a household can have.
+const (
+	// Manages the household and its members, and can do everything editors can.
+	HouseholdOwner = "owner"
+	// Creates, edits and deletes ownerships, locations and borrowers.
+	HouseholdEditor = "editor"
+	// Can only look at the inventory.
+	HouseholdViewer = "viewer"
+	// Can look at the inventory and check items out and in.
+	HouseholdBorrowOnly = "borrow-only"
+)
+
+// Represents a shared inventory that owns locations, ownerships and borrowers.
+type Household struct {
+	HouseholdUID   uint      `json:"householdUID" gorm:"primary_key;column:household_uid"`
+	HouseholdName  string    `json:"householdName" gorm:"column:household_name"`
+	HouseholdOwner uint      `json:"householdOwner" gorm:"column:household_owner;index"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// Represents the membership of a user in a household.
+type Membership struct {
+	MembershipUID uint      `json:"membershipUID" gorm:"primary_key;column:membership_uid"`
+	Household     uint      `json:"householdUID" gorm:"column:household;uniqueIndex:idx_membership_household_user"`
+	MemberUser    uint      `json:"userUID" gorm:"column:member_user;uniqueIndex:idx_membership_household_user;index"`
+	MemberRole    string    `json:"role" gorm:"type:varchar(32);column:member_role"`
+	JoinedAt      time.Time `json:"joinedAt" gorm:"column:joined_at"`
+	User          User      `json:"user" gorm:"foreignkey:member_user"`
+}
+
+// Represents an invitation to join a household, addressed to an existing user or to an email address.
+type HouseholdInvitation struct {
+	InvitationUID uint       `json:"invitationUID" gorm:"primary_key;column:invitation_uid"`
+	Household     uint       `json:"householdUID" gorm:"column:household;index"`
+	InvitedBy     uint       `json:"invitedBy" gorm:"column:invited_by"`
+	InviteeUser   uint       `json:"-" gorm:"column:invitee_user;index"`
+	InviteeEmail  string     `json:"email" gorm:"type:varchar(191);column:invitee_email;index"`
+	InviteeRole   string     `json:"role" gorm:"type:varchar(32);column:invitee_role"`
+	ExpiresAt     time.Time  `json:"expiresAt" gorm:"column:expires_at"`
+	AcceptedAt    *time.Time `json:"acceptedAt,omitempty" gorm:"column:accepted_at"`
+	DeclinedAt    *time.Time `json:"declinedAt,omitempty" gorm:"column:declined_at"`
+	CreatedAt     time.Time  `json:"createdAt" gorm:"column:created_at"`
+	HouseholdInfo Household  `json:"household" gorm:"foreignkey:household"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// Represents a location and one of the locations it is inside of, at any depth.
+// Every location also has a row with itself as the ancestor and a depth of 0.
+type LocationClosure struct {
+	Ancestor         uint `json:"ancestor" gorm:"primary_key;autoIncrement:false;column:ancestor"`
+	Descendant       uint `json:"descendant" gorm:"primary_key;autoIncrement:false;column:descendant;index"`
+	Depth            int  `json:"depth" gorm:"column:depth"`
+	ClosureHousehold uint `json:"-" gorm:"column:closure_household;index"`
+}
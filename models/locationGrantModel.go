@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Represents access to a location, and every location and ownership inside it, granted to a user outside the household.
+type LocationGrant struct {
+	GrantUID       uint       `json:"grantUID" gorm:"primary_key;column:grant_uid"`
+	GrantLocation  uint       `json:"locationUID" gorm:"column:grant_location;uniqueIndex:idx_grant_location_user"`
+	GrantHousehold uint       `json:"householdUID" gorm:"column:grant_household;index"`
+	GrantUser      uint       `json:"userUID" gorm:"column:grant_user;uniqueIndex:idx_grant_location_user;index"`
+	GrantRole      string     `json:"role" gorm:"type:varchar(32);column:grant_role"`
+	GrantedBy      uint       `json:"grantedBy" gorm:"column:granted_by"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"column:created_at"`
+	User           PublicUser `json:"user" gorm:"foreignkey:grant_user"`
+	Location       Location   `json:"location" gorm:"foreignkey:grant_location"`
+}
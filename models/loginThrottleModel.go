@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Represents the failed login attempts of a username or an IP address.
+type LoginThrottle struct {
+	ThrottleKey string     `json:"throttleKey" gorm:"type:varchar(191);primary_key;column:throttle_key"`
+	Failures    int        `json:"failures" gorm:"column:failures;default:0"`
+	LastFailure time.Time  `json:"lastFailure" gorm:"column:last_failure"`
+	LockedUntil *time.Time `json:"lockedUntil" gorm:"column:locked_until"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// The kinds of events shown in the history of an ownership.
+const (
+	OwnershipCreated    = "created"
+	OwnershipEdited     = "edited"
+	OwnershipQuantity   = "quantity"
+	OwnershipMoved      = "moved"
+	OwnershipCheckedOut = "checked_out"
+	OwnershipCheckedIn  = "checked_in"
+	OwnershipDeleted    = "deleted"
+	OwnershipRestored   = "restored"
+)
+
+// Represents a single entry in the history of an ownership.
+// Names are stored as they were at the time, so the history still reads correctly after they change.
+type OwnershipEvent struct {
+	EventUID       uint      `json:"eventUID" gorm:"primary_key;column:event_uid"`
+	EventOwnership uint      `json:"ownershipUID" gorm:"column:event_ownership;index"`
+	EventHousehold uint      `json:"-" gorm:"column:event_household;index"`
+	EventType      string    `json:"type" gorm:"type:varchar(32);column:event_type"`
+	Actor          uint      `json:"-" gorm:"column:actor"`
+	Summary        string    `json:"summary" gorm:"column:summary"`
+	FromValue      string    `json:"from,omitempty" gorm:"column:from_value"`
+	ToValue        string    `json:"to,omitempty" gorm:"column:to_value"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"column:created_at"`
+	ActorName      string    `json:"actor" gorm:"-"`
+	User           User      `json:"-" gorm:"foreignkey:actor;constraint:-"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Represents a user-generated token for scripts, limited to a set of scopes.
+// Only the SHA-256 hash of the token is stored, the prefix is kept to identify the token.
+type PersonalAccessToken struct {
+	TokenUID    uint       `json:"tokenUID" gorm:"primary_key;column:pat_uid"`
+	TokenUser   uint       `json:"-" gorm:"column:pat_user;index"`
+	TokenName   string     `json:"tokenName" gorm:"column:pat_name"`
+	TokenPrefix string     `json:"tokenPrefix" gorm:"type:varchar(16);column:pat_prefix"`
+	TokenHash   string     `json:"-" gorm:"type:varchar(64);column:pat_hash;uniqueIndex"`
+	Scopes      string     `json:"scopes" gorm:"column:scopes"`
+	ExpiresAt   *time.Time `json:"expiresAt" gorm:"column:expires_at"`
+	LastUsedAt  *time.Time `json:"lastUsedAt" gorm:"column:last_used_at"`
+	CreatedAt   time.Time  `json:"createdAt" gorm:"column:created_at"`
+	RevokedAt   *time.Time `json:"-" gorm:"column:revoked_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Represents a single-use recovery code for a user with two-factor authentication.
+// Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	RecoveryCodeUID uint       `json:"-" gorm:"primary_key;column:recovery_code_uid"`
+	CodeUser        uint       `json:"-" gorm:"column:code_user;index"`
+	CodeHash        string     `json:"-" gorm:"type:varchar(64);column:code_hash"`
+	UsedAt          *time.Time `json:"-" gorm:"column:used_at"`
+}
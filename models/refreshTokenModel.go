@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Represents a long-lived refresh token that can be exchanged for a new access token.
+// Only the SHA-256 hash of the token is stored. Tokens are rotated within the session they were issued for.
+type RefreshToken struct {
+	RefreshTokenUID uint       `json:"-" gorm:"primary_key;column:refresh_token_uid"`
+	TokenUser       uint       `json:"-" gorm:"column:token_user;index"`
+	TokenSession    uint       `json:"-" gorm:"column:token_session;index"`
+	TokenHash       string     `json:"-" gorm:"type:varchar(64);column:token_hash;uniqueIndex"`
+	ExpiresAt       time.Time  `json:"-" gorm:"column:expires_at"`
+	UsedAt          *time.Time `json:"-" gorm:"column:used_at"`
+	RevokedAt       *time.Time `json:"-" gorm:"column:revoked_at"`
+	CreatedAt       time.Time  `json:"-" gorm:"column:created_at"`
+}
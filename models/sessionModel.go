@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Represents a single logged in device of a user.
+type Session struct {
+	SessionUID  uint       `json:"sessionUID" gorm:"primary_key;column:session_uid"`
+	SessionUser uint       `json:"-" gorm:"column:session_user;index"`
+	DeviceName  string     `json:"deviceName" gorm:"column:device_name"`
+	UserAgent   string     `json:"userAgent" gorm:"column:user_agent"`
+	IPAddress   string     `json:"ipAddress" gorm:"type:varchar(64);column:ip_address"`
+	CreatedAt   time.Time  `json:"createdAt" gorm:"column:created_at"`
+	LastSeen    time.Time  `json:"lastSeen" gorm:"column:last_seen"`
+	RevokedAt   *time.Time `json:"-" gorm:"column:revoked_at"`
+	Current     bool       `json:"current" gorm:"-"`
+}
@@ -0,0 +1,55 @@
+package models
+
+// Represents the quotas of an account tier. A negative limit means unlimited.
+type Tier struct {
+	Name                 string `json:"name"`
+	MaxOwnerships        int64  `json:"maxOwnerships"`
+	MaxLocations         int64  `json:"maxLocations"`
+	MaxBorrowers         int64  `json:"maxBorrowers"`
+	BarcodeLookupsPerDay int64  `json:"barcodeLookupsPerDay"`
+	ImageStorageBytes    int64  `json:"imageStorageBytes"`
+}
+
+// Represents how much of each tier quota a user is currently using.
+type TierUsage struct {
+	Ownerships          int64 `json:"ownerships"`
+	Locations           int64 `json:"locations"`
+	Borrowers           int64 `json:"borrowers"`
+	BarcodeLookupsToday int64 `json:"barcodeLookupsToday"`
+	ImageStorageBytes   int64 `json:"imageStorageBytes"`
+}
+
+// The tiers a user can be on, keyed by the value stored in User.Tier.
+var Tiers = map[string]Tier{
+	"free": {
+		Name:                 "free",
+		MaxOwnerships:        500,
+		MaxLocations:         50,
+		MaxBorrowers:         20,
+		BarcodeLookupsPerDay: 50,
+		ImageStorageBytes:    5 << 20,
+	},
+	"premium": {
+		Name:                 "premium",
+		MaxOwnerships:        10000,
+		MaxLocations:         1000,
+		MaxBorrowers:         500,
+		BarcodeLookupsPerDay: 1000,
+		ImageStorageBytes:    500 << 20,
+	},
+	"unlimited": {
+		Name:                 "unlimited",
+		MaxOwnerships:        -1,
+		MaxLocations:         -1,
+		MaxBorrowers:         -1,
+		BarcodeLookupsPerDay: -1,
+		ImageStorageBytes:    -1,
+	},
+}
+
+// Counts the barcode lookups of a user on a single day.
+type UsageCounter struct {
+	CounterUser    uint   `json:"-" gorm:"primary_key;autoIncrement:false;column:counter_user"`
+	CounterDay     string `json:"day" gorm:"type:varchar(10);primary_key;column:counter_day"`
+	BarcodeLookups int64  `json:"barcodeLookups" gorm:"column:barcode_lookups;default:0"`
+}
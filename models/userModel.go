@@ -1,13 +1,37 @@
 package models
 
+import "time"
+
+// The role of a regular user.
+const RoleUser = "user"
+
+// The role of a user that can operate the server through the admin API.
+const RoleAdmin = "admin"
+
 // Represents information about User profiles.
 type User struct {
-	UserUID      uint   `json:"userUID" gorm:"primary_key;column:user_uid"`
-	Username     string `json:"username" gorm:"column:username"`
-	Email        string `json:"email" gorm:"column:email"`
-	Salt         string `json:"-" gorm:"column:salt"`
-	Hash         string `json:"-" gorm:"column:hash"`
-	EmailConfirm string `json:"emailConfirmed" gorm:"column:email_confirm;default:false"`
-	Tier	     string `json:"tier" gorm:"column:tier"`
-	Token        string `json:"-" gorm:"column:token"`
+	UserUID             uint       `json:"userUID" gorm:"primary_key;column:user_uid"`
+	Username            string     `json:"username" gorm:"column:username"`
+	Email               string     `json:"email" gorm:"column:email"`
+	Salt                string     `json:"-" gorm:"column:salt"`
+	Hash                string     `json:"-" gorm:"column:hash"`
+	EmailConfirm        string     `json:"emailConfirmed" gorm:"column:email_confirm;default:false"`
+	Tier                string     `json:"tier" gorm:"column:tier"`
+	Role                string     `json:"role" gorm:"column:role;default:user"`
+	Disabled            bool       `json:"disabled" gorm:"column:disabled;default:false"`
+	TOTPSecret          string     `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabled         bool       `json:"totpEnabled" gorm:"column:totp_enabled;default:false"`
+	TOTPLastCounter     int64      `json:"-" gorm:"column:totp_last_counter"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty" gorm:"column:deletion_scheduled_at"`
+}
+
+// Represents the part of a user that other users may see, e.g. on the ownerships and locations they created.
+type PublicUser struct {
+	UserUID  uint   `json:"userUID" gorm:"primary_key;column:user_uid"`
+	Username string `json:"username" gorm:"column:username"`
+}
+
+// Reads public users from the users table.
+func (PublicUser) TableName() string {
+	return "users"
 }
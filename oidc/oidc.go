@@ -0,0 +1,396 @@
+// Handles OpenID Connect logins with external identity providers.
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/joho/godotenv"
+)
+
+// How long discovery documents and signing keys are cached for.
+const cacheLifetime = time.Hour
+
+// Returned when a provider name is not configured in OIDC_PROVIDERS.
+var ErrUnknownProvider = errors.New("identity provider is not configured")
+
+// Returned when the ID token from a provider cannot be trusted.
+var ErrInvalidIDToken = errors.New("ID token is invalid")
+
+// The HTTP client used to talk to identity providers.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Represents an identity provider configured in the .env file.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Represents the verified identity returned by a provider.
+type Identity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+// Represents the fields of a discovery document that are used.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+	fetched               time.Time
+	keys                  map[string]*rsa.PublicKey
+}
+
+// Cached discovery documents and keys, keyed by issuer.
+var cache = struct {
+	sync.Mutex
+	documents map[string]*discovery
+}{documents: map[string]*discovery{}}
+
+/*
+* Retrieves the identity providers from the .env file.
+* OIDC_PROVIDERS lists the provider names, each configured with OIDC_<NAME>_ISSUER,
+* OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and optionally OIDC_<NAME>_SCOPES.
+*
+* @return map[string]Provider The configured providers, keyed by name.
+ */
+func Providers() map[string]Provider {
+	godotenv.Load()
+	providers := map[string]Provider{}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		scopes := strings.Fields(os.Getenv(prefix + "SCOPES"))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		providers[name] = Provider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       scopes,
+		}
+	}
+	return providers
+}
+
+/*
+* Retrieves a single configured identity provider.
+*
+* @param name The provider name.
+*
+* @return Provider The provider.
+* @return error ErrUnknownProvider, if it is not configured.
+ */
+func GetProvider(name string) (Provider, error) {
+	provider, ok := Providers()[strings.ToLower(name)]
+	if !ok || provider.Issuer == "" || provider.ClientID == "" {
+		return Provider{}, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+/*
+* Returns the names of the configured identity providers.
+*
+* @return []string The provider names, sorted.
+ */
+func ProviderNames() []string {
+	names := []string{}
+	for name := range Providers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+* Builds the PKCE code challenge for a code verifier.
+*
+* @param verifier The code verifier.
+*
+* @return string The S256 code challenge.
+ */
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+/*
+* Builds the URL the user is sent to in order to log in with the provider.
+*
+* @param state The state returned to the application with the authorization code.
+* @param nonce The nonce the ID token has to contain.
+* @param verifier The PKCE code verifier.
+*
+* @return string The authorization URL.
+* @return error The error message, if there is one.
+ */
+func (p Provider) AuthURL(state string, nonce string, verifier string) (string, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+/*
+* Exchanges an authorization code for an ID token and verifies it.
+*
+* @param code The authorization code returned by the provider.
+* @param nonce The nonce sent with the authorization request.
+* @param verifier The PKCE code verifier sent with the authorization request.
+*
+* @return Identity The verified identity.
+* @return error The error message, if there is one.
+ */
+func (p Provider) Exchange(code string, nonce string, verifier string) (Identity, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	resp, err := client.PostForm(doc.TokenEndpoint, form)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Identity{}, fmt.Errorf("oidc#Exchange: decoding token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return Identity{}, fmt.Errorf("oidc#Exchange: token endpoint returned %d %s", resp.StatusCode, body.Error)
+	}
+
+	return p.verify(body.IDToken, nonce)
+}
+
+/*
+* Verifies the signature, issuer, audience, expiry and nonce of an ID token.
+*
+* @param raw The ID token.
+* @param nonce The nonce sent with the authorization request.
+*
+* @return Identity The verified identity.
+* @return error ErrInvalidIDToken, if the token cannot be trusted.
+ */
+func (p Provider) verify(raw string, nonce string) (Identity, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, ErrInvalidIDToken
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	if !claims.VerifyIssuer(doc.Issuer, true) || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return Identity{}, ErrInvalidIDToken
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return Identity{}, ErrInvalidIDToken
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	identity := Identity{Issuer: doc.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	if identity.Subject == "" {
+		return Identity{}, ErrInvalidIDToken
+	}
+	return identity, nil
+}
+
+/*
+* Checks whether an aud claim, which may be a string or a list, contains the client ID.
+*
+* @param aud The aud claim.
+* @param clientID The client ID.
+*
+* @return bool Whether the audience contains the client ID.
+ */
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, value := range aud {
+			if value == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+* Retrieves the discovery document of the provider, using the cache when possible.
+*
+* @return *discovery The discovery document.
+* @return error The error message, if there is one.
+ */
+func (p Provider) discover() (*discovery, error) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if doc, ok := cache.documents[p.Issuer]; ok && time.Since(doc.fetched) < cacheLifetime {
+		return doc, nil
+	}
+
+	doc := &discovery{}
+	if err := getJSON(p.Issuer+"/.well-known/openid-configuration", doc); err != nil {
+		return nil, err
+	}
+	if doc.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc#discover: issuer %q does not match configured issuer %q", doc.Issuer, p.Issuer)
+	}
+
+	doc.fetched = time.Now()
+	cache.documents[p.Issuer] = doc
+	return doc, nil
+}
+
+/*
+* Retrieves a signing key of the provider, refreshing the key set when the key ID is unknown.
+*
+* @param kid The key ID from the token header.
+*
+* @return *rsa.PublicKey The signing key.
+* @return error The error message, if there is one.
+ */
+func (p Provider) key(kid string) (*rsa.PublicKey, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	if key, ok := doc.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(doc.JwksURI, &set); err != nil {
+		return nil, err
+	}
+
+	doc.keys = map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		doc.keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if key, ok := doc.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+/*
+* Performs a GET request and decodes the JSON response.
+*
+* @param url The URL to request.
+* @param target The value to decode the response into.
+*
+* @return error The error message, if there is one.
+ */
+func getJSON(url string, target interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc#getJSON: %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
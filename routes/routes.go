@@ -3,10 +3,28 @@ package routes
 
 import (
 	controller "WIG-Server/controller"
+	"WIG-Server/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+/*
+* Creates the Fiber application, checking the app authentication of every request and the token of every /app and /admin request,
+* and configures its routes.
+*
+* @return *fiber.App The configured application.
+ */
+func App() *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.AppAuth())
+	loggedRoutes := app.Group("/app")
+	loggedRoutes.Use(middleware.ValidateToken())
+	adminRoutes := app.Group("/admin")
+	adminRoutes.Use(middleware.ValidateToken(), middleware.RequireScope("admin"), middleware.RequireAdmin())
+	Setup(app)
+	return app
+}
+
 /*
 * Configures the routes on a Fiber application.
 *
@@ -17,32 +35,117 @@ func Setup(app *fiber.App) {
 	app.Post("/user/signup", controller.UserSignup)
 	app.Get("/user/salt", controller.UserSalt)
 	app.Post("/user/login", controller.UserLogin)
+	app.Post("/user/login/2fa", controller.UserLogin2FA)
+	app.Post("/user/refresh", controller.UserRefresh)
+	app.Post("/user/verify", controller.UserVerify)
+	app.Post("/user/forgot", controller.UserForgot)
+	app.Post("/user/reset", controller.UserReset)
+	app.Post("/user/unlock", controller.UserUnlock)
+	app.Get("/user/oidc/providers", controller.OIDCProviders)
+	app.Get("/user/oidc/:provider/start", controller.OIDCLoginStart)
+	app.Post("/user/oidc/:provider/callback", controller.OIDCLoginCallback)
 	app.Post("/app/validate", controller.UserValidate)
 
+	// Account Routes, only reachable with a session token
+	app.Use("/app/user", middleware.RequireScope("account"))
+	app.Get("/app/user/sessions", controller.UserSessions)
+	app.Delete("/app/user/sessions", controller.UserSessionRevoke)
+	app.Post("/app/user/logout", controller.UserLogout)
+	app.Post("/app/user/verify/resend", controller.UserVerifyResend)
+	app.Post("/app/user/2fa/enroll", controller.UserTwoFactorEnroll)
+	app.Post("/app/user/2fa/confirm", controller.UserTwoFactorConfirm)
+	app.Post("/app/user/2fa/recovery-codes", controller.UserTwoFactorRecoveryCodes)
+	app.Post("/app/user/2fa/disable", controller.UserTwoFactorDisable)
+	app.Put("/app/user/email", controller.UserChangeEmail)
+	app.Put("/app/user/password", controller.UserChangePassword)
+	app.Delete("/app/user/delete", controller.UserDelete)
+	app.Get("/app/user/tokens", controller.AccessTokenList)
+	app.Post("/app/user/tokens", controller.AccessTokenCreate)
+	app.Delete("/app/user/tokens", controller.AccessTokenRevoke)
+	app.Get("/app/user/oidc", controller.OIDCIdentities)
+	app.Get("/app/user/oidc/:provider/start", controller.OIDCLinkStart)
+	app.Post("/app/user/oidc/:provider/link", controller.OIDCLinkCallback)
+	app.Delete("/app/user/oidc", controller.OIDCUnlink)
+	app.Get("/app/user/usage", controller.UserUsage)
+
+	// Household Routes
+	app.Use("/app/household", middleware.RequireScope("account"))
+	app.Get("/app/household", controller.HouseholdList)
+	app.Post("/app/household/create", controller.HouseholdCreate)
+	app.Put("/app/household/edit", controller.HouseholdEdit)
+	app.Delete("/app/household/delete", controller.HouseholdDelete)
+	app.Get("/app/household/members", controller.HouseholdMembers)
+	app.Delete("/app/household/members", controller.HouseholdRemoveMember)
+	app.Put("/app/household/members/role", controller.HouseholdMemberRole)
+	app.Post("/app/household/leave", controller.HouseholdLeave)
+	app.Post("/app/household/invite", controller.HouseholdInvite)
+	app.Get("/app/household/invitations", controller.HouseholdInvitations)
+	app.Post("/app/household/invitations/accept", controller.HouseholdInvitationAccept)
+	app.Post("/app/household/invitations/decline", controller.HouseholdInvitationDecline)
+	app.Get("/app/household/shared", controller.HouseholdShared)
+
+	// Routes restricted to verified email addresses when REQUIRE_EMAIL_VERIFICATION is enabled
+	app.Use([]string{"/app/scan", "/app/ownership", "/app/location", "/app/borrower", "/app/audit", "/app/trash"}, middleware.RequireVerifiedEmail())
+
+	// Inventory routes work in the household chosen with the Household header
+	app.Use([]string{"/app/scan", "/app/ownership", "/app/location", "/app/borrower", "/app/audit", "/app/trash"}, middleware.ResolveHousehold())
+
 	// Scanner Routes
-	app.Post("/app/scan/barcode", controller.ScanBarcode)
-	app.Get("/app/scan/check-qr", controller.ScanCheckQR)
-	app.Get("/app/scan/qr/location", controller.ScanQRLocation)
+	scanRead := middleware.RequireScope("scan:read")
+	scanWrite := middleware.RequireScope("scan:write")
+	app.Post("/app/scan/barcode", scanWrite, controller.ScanBarcode)
+	app.Get("/app/scan/check-qr", scanRead, controller.ScanCheckQR)
+	app.Get("/app/scan/qr/location", scanRead, controller.ScanQRLocation)
 
 	// Ownership Routes
-	app.Post("/app/ownership/create", controller.OwnershipCreateNoItem)
-	app.Put("/app/ownership/quantity/:type", controller.OwnershipQuantity)
-	app.Put("/app/ownership/edit", controller.OwnershipEdit)
-	app.Put("/app/ownership/set-location", controller.OwnershipSetLocation)
-	app.Delete("/app/ownership/delete", controller.OwnershipDelete)
-	app.Post("/app/ownership/search", controller.OwnershipSearch)
+	ownershipRead := middleware.RequireScope("ownership:read")
+	ownershipWrite := middleware.RequireScope("ownership:write")
+	app.Post("/app/ownership/create", ownershipWrite, controller.OwnershipCreateNoItem)
+	app.Put("/app/ownership/quantity/:type", ownershipWrite, controller.OwnershipQuantity)
+	app.Put("/app/ownership/edit", ownershipWrite, controller.OwnershipEdit)
+	app.Put("/app/ownership/set-location", ownershipWrite, controller.OwnershipSetLocation)
+	app.Delete("/app/ownership/delete", ownershipWrite, controller.OwnershipDelete)
+	app.Post("/app/ownership/search", ownershipRead, controller.OwnershipSearch)
+	app.Get("/app/ownership/:id/history", ownershipRead, controller.OwnershipHistory)
 
 	// Location Routes
-	app.Post("/app/location/create", controller.LocationCreate)
-	app.Put("/app/location/set-location", controller.LocationSetLocation)
-	app.Put("/app/location/edit", controller.LocationEdit)
-	app.Post("/app/location/unpack", controller.UnpackLocation)
-	app.Post("/app/location/search", controller.LocationSearch)
+	locationRead := middleware.RequireScope("location:read")
+	locationWrite := middleware.RequireScope("location:write")
+	app.Post("/app/location/create", locationWrite, controller.LocationCreate)
+	app.Put("/app/location/set-location", locationWrite, controller.LocationSetLocation)
+	app.Put("/app/location/edit", locationWrite, controller.LocationEdit)
+	app.Delete("/app/location/delete", locationWrite, controller.LocationDelete)
+	app.Post("/app/location/unpack", locationRead, controller.UnpackLocation)
+	app.Get("/app/location/tree", locationRead, controller.LocationTree)
+	app.Post("/app/location/search", locationRead, controller.LocationSearch)
+	app.Get("/app/location/grants", locationRead, controller.LocationGrants)
+	app.Post("/app/location/grants", locationWrite, controller.LocationGrantCreate)
+	app.Delete("/app/location/grants", locationWrite, controller.LocationGrantRevoke)
 
 	// Borrower Routes
-	app.Post("/app/borrower/create", controller.CreateBorrower)
-	app.Post("/app/borrower/checkout", controller.CheckoutItem)
-	app.Post("/app/borrower/checkin", controller.CheckinItem)
-	app.Get("/app/borrower/get", controller.GetBorrowers)
-	app.Get("/app/borrower/getcheckedout", controller.GetCheckedOutItems)
+	borrowerRead := middleware.RequireScope("borrower:read")
+	borrowerWrite := middleware.RequireScope("borrower:write")
+	app.Post("/app/borrower/create", borrowerWrite, controller.CreateBorrower)
+	app.Post("/app/borrower/checkout", borrowerWrite, controller.CheckoutItem)
+	app.Post("/app/borrower/checkin", borrowerWrite, controller.CheckinItem)
+	app.Get("/app/borrower/get", borrowerRead, controller.GetBorrowers)
+	app.Get("/app/borrower/getcheckedout", borrowerRead, controller.GetCheckedOutItems)
+
+	// Audit Routes
+	app.Get("/app/audit", middleware.RequireScope("audit:read"), controller.AuditList)
+
+	// Trash Routes
+	app.Get("/app/trash", middleware.RequireScope("trash:read"), controller.TrashList)
+	app.Put("/app/trash/restore", middleware.RequireScope("trash:write"), controller.TrashRestore)
+	app.Delete("/app/trash/purge", middleware.RequireScope("trash:write"), controller.TrashPurge)
+
+	// Admin Routes
+	app.Get("/admin/users", controller.AdminUsers)
+	app.Get("/admin/user", controller.AdminUser)
+	app.Put("/admin/user/disable", controller.AdminUserDisable)
+	app.Put("/admin/user/tier", controller.AdminUserTier)
+	app.Get("/admin/items/stats", controller.AdminItemStats)
+	app.Get("/admin/items", controller.AdminItems)
+	app.Put("/admin/item", controller.AdminItemEdit)
+	app.Delete("/admin/item", controller.AdminItemDelete)
 }
@@ -0,0 +1,231 @@
+package routes
+
+import (
+	"WIG-Server/db"
+	"WIG-Server/db/dbtest"
+	"WIG-Server/models"
+	"WIG-Server/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The household roles the routes are tested with, and users outside the household with a viewer or borrow-only grant on one location.
+const (
+	owner      = models.HouseholdOwner
+	editor     = models.HouseholdEditor
+	viewer     = models.HouseholdViewer
+	borrowOnly = models.HouseholdBorrowOnly
+	guest      = "guest"
+	lender     = "lender"
+)
+
+// Who may use a route, by the permission it needs.
+var (
+	canView   = []string{owner, editor, viewer, borrowOnly}
+	canEdit   = []string{owner, editor}
+	canBorrow = []string{owner, editor, borrowOnly}
+	canManage = []string{owner}
+)
+
+// The records every route test starts with.
+type fixture struct {
+	household models.Household
+	tokens    map[string]string
+	garage    models.Location
+	attic     models.Location
+	trashed   models.Location
+	drill     models.Ownership
+	lent      models.Ownership
+	binned    models.Ownership
+	borrower  models.Borrower
+	grant     models.LocationGrant
+}
+
+// An inventory route and the request that succeeds on it for users allowed to use it.
+type route struct {
+	method  string
+	path    string
+	body    string
+	allowed []string
+}
+
+/*
+* Creates a user with a session and returns a token for it.
+*
+* @param t The test.
+* @param username The username.
+*
+* @return models.User The user.
+* @return string The users token.
+ */
+func testUser(t *testing.T, username string) (models.User, string) {
+	t.Helper()
+
+	user := models.User{Username: username, Email: username + "@example.com"}
+	db.DB.Create(&user)
+	session := models.Session{SessionUser: user.UserUID, CreatedAt: time.Now(), LastSeen: time.Now()}
+	db.DB.Create(&session)
+
+	token, err := utils.GenerateToken(user.UserUID, session.SessionUID, username)
+	if err != nil {
+		t.Fatalf("Generating a token for %s failed: %v", username, err)
+	}
+	return user, token
+}
+
+/*
+* Creates a household with a member for every role, grantees of the garage and the records the routes work on.
+*
+* @param t The test.
+*
+* @return fixture The created records.
+ */
+func setupFixture(t *testing.T) fixture {
+	t.Helper()
+	dbtest.Open(t)
+	t.Setenv("APP_SECRET", "test-secret")
+	t.Setenv("ALLOW_LEGACY_APP_SECRET", "true")
+	t.Setenv("TOKEN_SECRET", "test-token-secret")
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "false")
+
+	f := fixture{tokens: map[string]string{}}
+	users := map[string]models.User{}
+	for _, role := range []string{owner, editor, viewer, borrowOnly, guest, lender, "outsider"} {
+		users[role], f.tokens[role] = testUser(t, strings.ReplaceAll(role, "-", ""))
+	}
+
+	f.household = models.Household{HouseholdName: "Home", HouseholdOwner: users[owner].UserUID}
+	db.DB.Create(&f.household)
+	for _, role := range []string{owner, editor, viewer, borrowOnly} {
+		db.DB.Create(&models.Membership{Household: f.household.HouseholdUID, MemberUser: users[role].UserUID, MemberRole: role, JoinedAt: time.Now()})
+	}
+
+	location := func(name string) models.Location {
+		location := models.Location{LocationName: name, LocationQR: name + "-QR", LocationOwner: users[owner].UserUID, LocationHousehold: f.household.HouseholdUID}
+		db.DB.Create(&location)
+		return location
+	}
+	f.garage = location("Garage")
+	f.attic = location("Attic")
+	f.trashed = location("Cellar")
+	db.DB.Delete(&f.trashed)
+
+	item := models.Item{Barcode: "123456", Name: "Drill"}
+	db.DB.Create(&item)
+	f.borrower = models.Borrower{BorrowerName: "Neighbour", BorrowerOwner: users[owner].UserUID, BorrowerHousehold: f.household.HouseholdUID}
+	db.DB.Create(&f.borrower)
+
+	ownership := func(name string, itemNumber uint, borrower uint) models.Ownership {
+		ownership := models.Ownership{ItemOwner: users[owner].UserUID, ItemHousehold: f.household.HouseholdUID, ItemNumber: itemNumber, CustomItemName: name, ItemQR: name + "-QR", ItemLocation: f.garage.LocationUID, ItemBorrower: borrower, ItemQuantity: 1}
+		db.DB.Create(&ownership)
+		return ownership
+	}
+	f.drill = ownership("Drill", item.ItemUid, 1)
+	f.lent = ownership("Ladder", 1, f.borrower.BorrowerUID)
+	f.binned = ownership("Saw", 1, 1)
+	db.DB.Delete(&f.binned)
+	db.DB.Create(&models.OwnershipEvent{EventOwnership: f.drill.OwnershipUID, EventHousehold: f.household.HouseholdUID, EventType: models.OwnershipCreated, Actor: users[owner].UserUID, CreatedAt: time.Now()})
+
+	f.grant = models.LocationGrant{GrantLocation: f.garage.LocationUID, GrantHousehold: f.household.HouseholdUID, GrantUser: users[guest].UserUID, GrantRole: viewer, GrantedBy: users[owner].UserUID}
+	db.DB.Create(&f.grant)
+	db.DB.Create(&models.LocationGrant{GrantLocation: f.garage.LocationUID, GrantHousehold: f.household.HouseholdUID, GrantUser: users[lender].UserUID, GrantRole: borrowOnly, GrantedBy: users[owner].UserUID})
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error { return db.RebuildLocationClosures(tx) }); err != nil {
+		t.Fatalf("Building the location closures failed: %v", err)
+	}
+	return f
+}
+
+/*
+* Lists every inventory route with a request that succeeds for the users allowed to use it.
+*
+* @param f The records the requests work on.
+*
+* @return map[string]route The routes by name.
+ */
+func inventoryRoutes(f fixture) map[string]route {
+	shared := append([]string{guest, lender}, canView...)
+	borrowers := append([]string{lender}, canBorrow...)
+	return map[string]route{
+		"ScanBarcode":           {"POST", "/app/scan/barcode?barcode=123456", "", canView},
+		"ScanCheckQR":           {"GET", "/app/scan/check-qr?qr=" + f.drill.ItemQR, "", shared},
+		"ScanQRLocation":        {"GET", "/app/scan/qr/location?qr=" + f.garage.LocationQR, "", shared},
+		"OwnershipCreateNoItem": {"POST", "/app/ownership/create?item_uid=1", `{"name":"Hammer"}`, canEdit},
+		"OwnershipQuantity":     {"PUT", fmt.Sprintf("/app/ownership/quantity/increment?ownershipUID=%d&amount=1", f.drill.OwnershipUID), "", canEdit},
+		"OwnershipEdit":         {"PUT", fmt.Sprintf("/app/ownership/edit?ownershipUID=%d", f.drill.OwnershipUID), `{"customItemName":"Cordless drill","qr":"Drill-QR"}`, canEdit},
+		"OwnershipSetLocation":  {"PUT", fmt.Sprintf("/app/ownership/set-location?ownershipUID=%d&location_qr=%s", f.drill.OwnershipUID, f.attic.LocationQR), "", canEdit},
+		"OwnershipDelete":       {"DELETE", fmt.Sprintf("/app/ownership/delete?ownershipUID=%d", f.drill.OwnershipUID), "", canEdit},
+		"OwnershipSearch":       {"POST", "/app/ownership/search", `{"name":"Drill"}`, shared},
+		"OwnershipHistory":      {"GET", fmt.Sprintf("/app/ownership/%d/history", f.drill.OwnershipUID), "", shared},
+		"LocationCreate":        {"POST", "/app/location/create?location_qr=Shed-QR&location_name=Shed", "", canEdit},
+		"LocationSetLocation":   {"PUT", fmt.Sprintf("/app/location/set-location?location_uid=%d&set_location_uid=%d", f.attic.LocationUID, f.garage.LocationUID), "", canEdit},
+		"LocationEdit":          {"PUT", fmt.Sprintf("/app/location/edit?locationUID=%d&location_name=Loft", f.attic.LocationUID), "", canEdit},
+		"LocationDelete":        {"DELETE", fmt.Sprintf("/app/location/delete?locationUID=%d", f.attic.LocationUID), "", canEdit},
+		"UnpackLocation":        {"POST", fmt.Sprintf("/app/location/unpack?locationUID=%d", f.garage.LocationUID), "", shared},
+		"UnpackRecursive":       {"POST", fmt.Sprintf("/app/location/unpack?locationUID=%d&recursive=true", f.garage.LocationUID), "", shared},
+		"LocationTree":          {"GET", fmt.Sprintf("/app/location/tree?locationUID=%d", f.garage.LocationUID), "", shared},
+		"LocationSearch":        {"POST", "/app/location/search", `{"name":"Garage"}`, shared},
+		"LocationGrants":        {"GET", "/app/location/grants", "", canManage},
+		"LocationGrantCreate":   {"POST", fmt.Sprintf("/app/location/grants?locationUID=%d", f.attic.LocationUID), `{"username":"outsider"}`, canManage},
+		"LocationGrantRevoke":   {"DELETE", fmt.Sprintf("/app/location/grants?grantUID=%d", f.grant.GrantUID), "", canManage},
+		"CreateBorrower":        {"POST", "/app/borrower/create?borrower=Friend", "", canEdit},
+		"CheckoutItem":          {"POST", fmt.Sprintf("/app/borrower/checkout?borrowerUID=%d", f.borrower.BorrowerUID), fmt.Sprintf(`{"ownerships":[%d]}`, f.drill.OwnershipUID), borrowers},
+		"CheckinItem":           {"POST", "/app/borrower/checkin", fmt.Sprintf(`{"ownerships":[%d]}`, f.lent.OwnershipUID), borrowers},
+		"GetBorrowers":          {"GET", "/app/borrower/get", "", canView},
+		"GetCheckedOutItems":    {"GET", "/app/borrower/getcheckedout", "", canView},
+		"AuditList":             {"GET", "/app/audit", "", canView},
+		"TrashList":             {"GET", "/app/trash", "", canView},
+		"TrashRestore":          {"PUT", fmt.Sprintf("/app/trash/restore?ownershipUID=%d", f.binned.OwnershipUID), "", canEdit},
+		"TrashPurge":            {"DELETE", fmt.Sprintf("/app/trash/purge?locationUID=%d", f.trashed.LocationUID), "", canManage},
+	}
+}
+
+func TestInventoryRoutesByRole(t *testing.T) {
+	names := inventoryRoutes(fixture{})
+	for name := range names {
+		for _, role := range []string{owner, editor, viewer, borrowOnly, guest, lender} {
+			name, role := name, role
+			t.Run(name+"/"+role, func(t *testing.T) {
+				f := setupFixture(t)
+				r := inventoryRoutes(f)[name]
+
+				request := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+				request.Header.Set("Content-Type", "application/json")
+				request.Header.Set("AppAuth", "test-secret")
+				request.Header.Set("Authorization", "Bearer "+f.tokens[role])
+				request.Header.Set("Household", fmt.Sprint(f.household.HouseholdUID))
+
+				response, err := App().Test(request, -1)
+				if err != nil {
+					t.Fatalf("Request failed: %v", err)
+				}
+				raw, _ := io.ReadAll(response.Body)
+				var body map[string]interface{}
+				json.Unmarshal(raw, &body)
+
+				// Members and grantees only ever see each others usernames
+				if strings.Contains(string(raw), "@example.com") {
+					t.Errorf("%s %s shows an email address: %s", r.method, r.path, raw)
+				}
+
+				allowed := false
+				for _, a := range r.allowed {
+					allowed = allowed || a == role
+				}
+				if allowed && response.StatusCode != 200 {
+					t.Errorf("%s %s returned %d, want 200: %v", r.method, r.path, response.StatusCode, body["message"])
+				}
+				if !allowed && (response.StatusCode != 403 || body["reason"] != "permission_denied") {
+					t.Errorf("%s %s returned %d %v, want 403 permission_denied", r.method, r.path, response.StatusCode, body["reason"])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Runs periodic maintenance jobs in the background of the WIG-Server application.
+package tasks
+
+import (
+	"WIG-Server/controller"
+	"log"
+	"time"
+)
+
+// How often the maintenance jobs are run.
+const interval = time.Hour
+
+// The jobs run on every interval, in order.
+var jobs = []struct {
+	name string
+	run  func()
+}{
+	{"purge scheduled accounts", controller.PurgeScheduledAccounts},
+	{"purge trash", controller.PurgeTrash},
+	{"repair location cycles", func() { controller.RepairLocationCycles() }},
+}
+
+/*
+* Starts running the maintenance jobs in a background goroutine.
+ */
+func Start() {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			runJobs()
+			<-ticker.C
+		}
+	}()
+}
+
+/*
+* Runs each job once, recovering from panics so a failing job does not stop the others.
+ */
+func runJobs() {
+	for _, job := range jobs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("tasks#runJobs: Job %q panicked: %v", job.name, r)
+				}
+			}()
+			job.run()
+		}()
+	}
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/argon2"
+)
+
+// The prefix of a stored hash that was produced by HashPassword.
+const argon2Prefix = "$argon2id$"
+
+// Returned by VerifyPassword when a stored Argon2id hash cannot be decoded.
+var ErrInvalidHash = errors.New("stored password hash is malformed")
+
+// Represents the tunable Argon2id cost parameters.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+/*
+* Retrieves the Argon2id parameters from the .env file, falling back to the recommended defaults.
+* PASSWORD_MEMORY is given in KiB.
+*
+* @return Argon2Params The parameters new hashes are created with.
+ */
+func PasswordParams() Argon2Params {
+	godotenv.Load()
+	return Argon2Params{
+		Memory:      uint32(envUint("PASSWORD_MEMORY", 64*1024, 32)),
+		Iterations:  uint32(envUint("PASSWORD_ITERATIONS", 3, 32)),
+		Parallelism: uint8(envUint("PASSWORD_PARALLELISM", 2, 8)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+/*
+* Reads a positive integer from the environment.
+*
+* @param key The name of the environment variable.
+* @param fallback The value used when the variable is missing or invalid.
+* @param bits The bit size the value must fit in.
+*
+* @return uint64 The parsed value.
+ */
+func envUint(key string, fallback uint64, bits int) uint64 {
+	value, err := strconv.ParseUint(os.Getenv(key), 10, bits)
+	if err != nil || value == 0 {
+		return fallback
+	}
+	return value
+}
+
+/*
+* Hashes the credential sent by the WIG-Application with Argon2id.
+*
+* @param password The credential to hash.
+*
+* @return string The encoded hash, including its parameters and salt.
+* @return error The error message, if there is one.
+ */
+func HashPassword(password string) (string, error) {
+	params := PasswordParams()
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+/*
+* Compares a credential against a stored hash in constant time.
+* Stored values that predate server-side hashing are compared directly and always flagged for rehashing.
+*
+* @param password The credential sent by the WIG-Application.
+* @param encoded The stored hash.
+*
+* @return bool Whether the credential matches.
+* @return bool Whether the stored hash should be replaced with one using the current parameters.
+* @return error The error message, if there is one.
+ */
+func VerifyPassword(password string, encoded string) (bool, bool, error) {
+	if !strings.HasPrefix(encoded, argon2Prefix) {
+		match := subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) == 1
+		return match, match, nil
+	}
+
+	params, salt, key, err := decodeHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	current := PasswordParams()
+	rehash := params.Memory != current.Memory || params.Iterations != current.Iterations || params.Parallelism != current.Parallelism
+	return true, rehash, nil
+}
+
+/*
+* Decodes a hash produced by HashPassword.
+*
+* @param encoded The stored hash.
+*
+* @return Argon2Params The parameters the hash was created with.
+* @return []byte The salt.
+* @return []byte The derived key.
+* @return error The error message, if there is one.
+ */
+func decodeHash(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+import "strings"
+
+/*
+* Splits a comma separated list of scopes.
+*
+* @param scopes The comma separated scopes.
+*
+* @return []string The trimmed, non-empty scopes.
+ */
+func SplitScopes(scopes string) []string {
+	var result []string
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+/*
+* Checks whether a list of granted scopes covers the required scope.
+* "*" grants everything, and "name:*" grants every scope starting with "name:".
+*
+* @param granted The comma separated scopes that were granted.
+* @param required The scope required for the request.
+*
+* @return bool Whether the required scope was granted.
+ */
+func ScopeAllows(granted string, required string) bool {
+	for _, scope := range SplitScopes(granted) {
+		if scope == "*" || scope == required {
+			return true
+		}
+		if strings.HasSuffix(scope, ":*") && strings.HasPrefix(required, strings.TrimSuffix(scope, "*")) {
+			return true
+		}
+	}
+	return false
+}
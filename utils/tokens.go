@@ -2,34 +2,256 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/joho/godotenv"
 )
 
+// The default lifetime of an access token when TOKEN_LIFETIME is not set.
+const defaultTokenLifetime = 24 * time.Hour
+
+// The default lifetime of a refresh token when REFRESH_TOKEN_LIFETIME is not set.
+const defaultRefreshTokenLifetime = 30 * 24 * time.Hour
+
+// Returned by ParseToken when the token has passed its exp claim.
+var ErrTokenExpired = errors.New("token has expired")
+
+// Returned by ParseToken when the token is malformed or its signature does not match.
+var ErrTokenInvalid = errors.New("token is invalid")
+
+// Represents the claims stored inside of a single-use action token, such as an email verification link.
+type ActionClaims struct {
+	Purpose string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// Represents the claims stored inside of a WIG access token.
+type TokenClaims struct {
+	Username   string `json:"username"`
+	SessionUID uint   `json:"sid"`
+	jwt.StandardClaims
+}
+
+/*
+* Retrieves the secret used to sign tokens from the .env file.
+*
+* @return []byte The token secret.
+ */
+func tokenSecret() []byte {
+	godotenv.Load()
+	return []byte(os.Getenv("TOKEN_SECRET"))
+}
+
+/*
+* Retrieves a duration from the .env file.
+* Values accept any time.ParseDuration format, e.g. "24h" or "90m".
+*
+* @param key The name of the environment variable.
+* @param fallback The duration used when the variable is missing or invalid.
+*
+* @return time.Duration The configured duration.
+ */
+func EnvDuration(key string, fallback time.Duration) time.Duration {
+	godotenv.Load()
+	duration, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
 /*
-* Generates a randomized authentication token for API calls between the WIG-Application and server.
+* Retrieves the access token lifetime from the .env file.
 *
+* @return time.Duration The lifetime of an access token.
+ */
+func TokenLifetime() time.Duration {
+	return EnvDuration("TOKEN_LIFETIME", defaultTokenLifetime)
+}
+
+/*
+* Retrieves the refresh token lifetime from the .env file.
+*
+* @return time.Duration The lifetime of a refresh token.
+ */
+func RefreshTokenLifetime() time.Duration {
+	return EnvDuration("REFRESH_TOKEN_LIFETIME", defaultRefreshTokenLifetime)
+}
+
+/*
+* Generates a cryptographically random, URL safe token.
+*
+* @param size The number of random bytes in the token.
+*
+* @return string The generated token.
+* @return error The error message, if there is one.
+ */
+func GenerateRandomToken(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+/*
+* Hashes a token so it can be stored and looked up without keeping the token itself.
+*
+* @param token The token to hash.
+*
+* @return string The hex encoded SHA-256 hash of the token.
+ */
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+* Generates a signed authentication token for API calls between the WIG-Application and server.
+*
+* @param uid The users UID, stored as the sub claim.
+* @param sessionUID The UID of the session the token belongs to.
 * @param username The username.
-* @param hash The hashed password.
 *
 * @return string The generated authentication token.
+* @return error The error message, if there is one.
  */
-func GenerateToken(username string, hash string) string {
-	godotenv.Load()
-	var secret = []byte(os.Getenv("TOKEN_SECRET"))
+func GenerateToken(uid uint, sessionUID uint, username string) (string, error) {
+	now := time.Now()
 
 	// Generate access token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": username,
-		"hash":     hash,
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+		Username:   username,
+		SessionUID: sessionUID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.FormatUint(uint64(uid), 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(TokenLifetime()).Unix(),
+		},
 	})
-	tokenStr, err := token.SignedString(secret)
+	return token.SignedString(tokenSecret())
+}
+
+/*
+* Verifies the signature and expiry of an authentication token.
+*
+* @param tokenStr The token sent by the WIG-Application.
+*
+* @return *TokenClaims The claims stored in the token.
+* @return error ErrTokenExpired or ErrTokenInvalid, if the token cannot be used.
+ */
+func ParseToken(tokenStr string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrTokenInvalid
+		}
+		return tokenSecret(), nil
+	})
+
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrTokenInvalid
+	}
+	if !token.Valid || claims.Subject == "" || claims.ExpiresAt == 0 || claims.SessionUID == 0 {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
 
-	// Return error if access token generation fails
+/*
+* Retrieves the users UID stored in the sub claim.
+*
+* @return uint The users UID.
+* @return error The error message, if there is one.
+ */
+func (claims *TokenClaims) UserUID() (uint, error) {
+	uid, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrTokenInvalid
+	}
+	return uint(uid), nil
+}
+
+/*
+* Generates a signed, single-use token for an action such as verifying an email address.
+* The jti claim is stored in the database so the token can only be used once.
+*
+* @param uid The users UID, stored as the sub claim.
+* @param purpose The action the token may be used for.
+* @param tokenID The unique ID stored as the jti claim.
+* @param lifetime How long the token stays valid.
+*
+* @return string The generated action token.
+* @return error The error message, if there is one.
+ */
+func GenerateActionToken(uid uint, purpose string, tokenID string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, ActionClaims{
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Subject:   strconv.FormatUint(uint64(uid), 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(lifetime).Unix(),
+		},
+	})
+	return token.SignedString(tokenSecret())
+}
+
+/*
+* Verifies the signature, expiry and purpose of an action token.
+*
+* @param tokenStr The action token.
+* @param purpose The action the token is being used for.
+*
+* @return *ActionClaims The claims stored in the token.
+* @return error ErrTokenExpired or ErrTokenInvalid, if the token cannot be used.
+ */
+func ParseActionToken(tokenStr string, purpose string) (*ActionClaims, error) {
+	claims := &ActionClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrTokenInvalid
+		}
+		return tokenSecret(), nil
+	})
+
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrTokenInvalid
+	}
+	if !token.Valid || claims.Purpose != purpose || claims.Id == "" || claims.ExpiresAt == 0 {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+/*
+* Retrieves the users UID stored in the sub claim.
+*
+* @return uint The users UID.
+* @return error The error message, if there is one.
+ */
+func (claims *ActionClaims) UserUID() (uint, error) {
+	uid, err := strconv.ParseUint(claims.Subject, 10, 64)
 	if err != nil {
-		return "error"
+		return 0, ErrTokenInvalid
 	}
-	return tokenStr
+	return uint(uid), nil
 }
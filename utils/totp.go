@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The number of seconds each TOTP code is valid for.
+const totpPeriod = 30
+
+// The number of digits in a TOTP code.
+const totpDigits = 6
+
+// The number of periods before and after the current one that are still accepted, to allow for clock drift.
+const totpSkew = 1
+
+// The base32 encoding used for TOTP secrets, as expected by authenticator apps.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+/*
+* Generates a random secret for TOTP two-factor authentication.
+*
+* @return string The base32 encoded secret.
+* @return error The error message, if there is one.
+ */
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+/*
+* Builds the otpauth URI an authenticator app reads from a QR code.
+*
+* @param issuer The name shown in the authenticator app.
+* @param account The account name, usually the username.
+* @param secret The base32 encoded secret.
+*
+* @return string The otpauth URI.
+ */
+func TOTPURI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+/*
+* Calculates the TOTP code for a counter as described in RFC 6238.
+*
+* @param secret The base32 encoded secret.
+* @param counter The number of periods since the Unix epoch.
+*
+* @return string The code.
+* @return error The error message, if there is one.
+ */
+func totpCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+/*
+* Checks a TOTP code against the current time.
+* Codes for counters at or before lastCounter are rejected so a code cannot be replayed.
+*
+* @param secret The base32 encoded secret.
+* @param code The code entered by the user.
+* @param lastCounter The counter of the last code that was accepted.
+*
+* @return int64 The counter the code matched, which should be stored as the new lastCounter.
+* @return bool Whether the code is valid.
+ */
+func ValidateTOTP(secret string, code string, lastCounter int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := totpCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}